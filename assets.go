@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+)
+
+//go:embed files/assets
+var assetFiles embed.FS
+
+const (
+	assetsEmbedded = "embedded"
+	assetsCDN      = "cdn"
+)
+
+// cache-control of the assets. the urls with the content hash never change
+const (
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	assetCacheControl     = "public, max-age=0, must-revalidate"
+)
+
+// embeddedAsset is a file served under /assets/
+type embeddedAsset struct {
+	body        []byte
+	contentType string
+	hash        string
+	// e.g. statusboard.0123456789ab.css
+	hashedName string
+}
+
+type assetSet struct {
+	// by the plain name and the hashed name
+	byName map[string]*embeddedAsset
+	// plain name -> hashed name
+	hashed map[string]string
+}
+
+var assets = mustLoadAssets(assetFiles, "files/assets")
+
+func mustLoadAssets(fsys fs.FS, dir string) *assetSet {
+	set := &assetSet{byName: map[string]*embeddedAsset{}, hashed: map[string]string{}}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			panic(err)
+		}
+		sum := sha256.Sum256(body)
+		ext := path.Ext(name)
+		a := &embeddedAsset{
+			body:        body,
+			contentType: mime.TypeByExtension(ext),
+			hash:        hex.EncodeToString(sum[:]),
+		}
+		a.hashedName = strings.TrimSuffix(name, ext) + "." + a.hash[:12] + ext
+		if a.contentType == "" {
+			a.contentType = "application/octet-stream"
+		}
+		set.byName[name] = a
+		set.byName[a.hashedName] = a
+		set.hashed[name] = a.hashedName
+	}
+	return set
+}
+
+// path returns the url of the asset with the content hash, so that the browsers can cache it forever
+func (s *assetSet) path(name string) string {
+	if hashed, ok := s.hashed[name]; ok {
+		return "/assets/" + hashed
+	}
+	return "/assets/" + name
+}
+
+// UseCDN reports whether the pages load the css from the CDN instead of /assets/
+func (c *Config) UseCDN() bool {
+	return c.Assets == assetsCDN
+}
+
+func (o *Opt) handleAsset(c *echo.Context) error {
+	name := c.Param("name")
+	a, ok := assets.byName[name]
+	if !ok {
+		return echo.ErrNotFound
+	}
+	h := c.Response().Header()
+	etag := `"` + a.hash + `"`
+	h.Set("ETag", etag)
+	if name == a.hashedName {
+		h.Set("Cache-Control", immutableCacheControl)
+	} else {
+		h.Set("Cache-Control", assetCacheControl)
+	}
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, a.contentType, a.body)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAssets(t *testing.T) {
+	opt := newTestOpt(t)
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`href="(/assets/statusboard\.[0-9a-f]{12}\.css)"`).FindStringSubmatch(string(opt.htmlBlob))
+	if m == nil {
+		t.Fatalf("index should link to the embedded css")
+	}
+	if strings.Contains(string(opt.htmlBlob), "cdnjs") {
+		t.Errorf("index should not load the css from the CDN")
+	}
+
+	e := opt.buildHandler()
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := get(m[1], "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/css") ||
+		rec.Header().Get("Cache-Control") != immutableCacheControl || !strings.Contains(rec.Body.String(), ".fa-check-square") {
+		t.Errorf("GET %s = %d %v", m[1], rec.Code, rec.Header())
+	}
+	if rec := get(m[1], rec.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("GET %s with ETag = %d, want 304", m[1], rec.Code)
+	}
+	// ハッシュのないURLはキャッシュさせない
+	if rec := get("/assets/statusboard.css", ""); rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != assetCacheControl {
+		t.Errorf("GET /assets/statusboard.css = %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("/assets/statusboard.000000000000.css", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET unknown asset = %d, want 404", rec.Code)
+	}
+}
+
+func TestAssets_CDN(t *testing.T) {
+	conf, err := loadToml(writeTempToml(t, `
+assets = "cdn"
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(opt.htmlBlob), "cdnjs.cloudflare.com") || strings.Contains(string(opt.htmlBlob), "/assets/") {
+		t.Errorf("index should load the css from the CDN")
+	}
+
+	if _, err := loadToml(writeTempToml(t, `assets = "local"`)); err == nil || !strings.Contains(err.Error(), "line 1: error: assets") {
+		t.Errorf("loadToml error = %v, want an error of assets", err)
+	}
+}
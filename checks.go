@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// exit codes of built-in checks, following the Nagios plugin convention
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+)
+
+// maxHTTPBodySize limits how much of the response body is read for matching
+const maxHTTPBodySize = 1 << 20
+
+// defaultCertExpiryWarning is used when cert_expiry_warning is not set
+var defaultCertExpiryWarning = MustDuration("336h")
+
+func (s *Service) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: s.TLSSkipVerify,
+		ServerName:         s.TLSServerName,
+	}
+	if s.TLSCAFile != "" {
+		pem, err := os.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read tls_ca_file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in tls_ca_file %s", s.TLSCAFile)
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
+}
+
+func (s *Service) prepareHTTPCheck() error {
+	if s.URL == "" {
+		return errors.New("has no url")
+	}
+	if s.Method == "" {
+		s.Method = http.MethodGet
+	}
+	s.Method = strings.ToUpper(s.Method)
+	if s.BodyRegexp != "" {
+		re, err := regexp.Compile(s.BodyRegexp)
+		if err != nil {
+			return errors.Wrap(err, "invalid body_regexp")
+		}
+		s.bodyRegexp = re
+	}
+	tlsConf, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	s.httpClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   tlsConf,
+			DisableKeepAlives: true,
+		},
+	}
+	return nil
+}
+
+func (s *Service) expectedStatusCode(code int) bool {
+	if len(s.ExpectedStatus) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, c := range s.ExpectedStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Opt) execHTTPCheck(ctx context.Context, service *Service) (int, string, error) {
+	if !service.Timeout.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.Timeout.Duration)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, service.Method, service.URL, nil)
+	if err != nil {
+		return ErrorStatusCode, "", err
+	}
+	for k, v := range service.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	res, err := service.httpClient.Do(req)
+	if err != nil {
+		return CheckCritical, fmt.Sprintf("%s %s failed: %v", service.Method, service.URL, err), nil
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxHTTPBodySize))
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		return CheckCritical, fmt.Sprintf("HTTP %s in %s: failed to read body: %v", res.Status, latency, err), nil
+	}
+
+	summary := fmt.Sprintf("HTTP %s in %s", res.Status, latency)
+	if !service.expectedStatusCode(res.StatusCode) {
+		return CheckCritical, summary + ": unexpected status code", nil
+	}
+	if service.BodyContains != "" && !bytes.Contains(body, []byte(service.BodyContains)) {
+		return CheckCritical, fmt.Sprintf("%s: body does not contain %q", summary, service.BodyContains), nil
+	}
+	if service.bodyRegexp != nil && !service.bodyRegexp.Match(body) {
+		return CheckCritical, fmt.Sprintf("%s: body does not match %q", summary, service.BodyRegexp), nil
+	}
+	return CheckOK, summary, nil
+}
+
+func (s *Service) prepareTCPCheck() error {
+	if s.Address == "" {
+		return errors.New("has no address")
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return errors.Wrap(err, "invalid address")
+	}
+	return nil
+}
+
+func (s *Service) prepareTLSCheck() error {
+	if err := s.prepareTCPCheck(); err != nil {
+		return err
+	}
+	if s.CertExpiryWarning.IsZero() {
+		s.CertExpiryWarning = defaultCertExpiryWarning
+	}
+	tlsConf, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	s.tlsClientConfig = tlsConf
+	return nil
+}
+
+func (o *Opt) execTCPCheck(ctx context.Context, service *Service) (int, string, error) {
+	if !service.Timeout.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.Timeout.Duration)
+		defer cancel()
+	}
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", service.Address)
+	if err != nil {
+		return CheckCritical, fmt.Sprintf("connect to %s failed: %v", service.Address, err), nil
+	}
+	defer conn.Close()
+	latency := time.Since(start).Round(time.Millisecond)
+	return CheckOK, fmt.Sprintf("connected to %s in %s", service.Address, latency), nil
+}
+
+func (o *Opt) execTLSCheck(ctx context.Context, service *Service) (int, string, error) {
+	if !service.Timeout.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.Timeout.Duration)
+		defer cancel()
+	}
+	start := time.Now()
+	d := tls.Dialer{Config: service.tlsClientConfig}
+	conn, err := d.DialContext(ctx, "tcp", service.Address)
+	if err != nil {
+		return CheckCritical, fmt.Sprintf("TLS handshake with %s failed: %v", service.Address, err), nil
+	}
+	defer conn.Close()
+	latency := time.Since(start).Round(time.Millisecond)
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return CheckCritical, fmt.Sprintf("TLS handshake with %s in %s: no peer certificate", service.Address, latency), nil
+	}
+	leaf := certs[0]
+	remaining := time.Until(leaf.NotAfter)
+	summary := fmt.Sprintf("TLS handshake with %s in %s, certificate %q expires at %s (%d days left)",
+		service.Address, latency, leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339), int(remaining.Hours()/24))
+	switch {
+	case remaining <= 0:
+		return CheckCritical, summary + ": certificate has expired", nil
+	case !service.CertExpiryCritical.IsZero() && remaining < service.CertExpiryCritical.Duration:
+		return CheckCritical, fmt.Sprintf("%s: certificate expires within %s", summary, service.CertExpiryCritical.ShortString()), nil
+	case remaining < service.CertExpiryWarning.Duration:
+		return CheckWarning, fmt.Sprintf("%s: certificate expires within %s", summary, service.CertExpiryWarning.ShortString()), nil
+	}
+	return CheckOK, summary, nil
+}
+
+var dnsRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "SRV", "PTR"}
+
+func (s *Service) prepareDNSCheck() error {
+	if s.Query == "" {
+		return errors.New("has no query")
+	}
+	if s.RecordType == "" {
+		s.RecordType = "A"
+	}
+	s.RecordType = strings.ToUpper(s.RecordType)
+	if !slices.Contains(dnsRecordTypes, s.RecordType) {
+		return errors.Errorf("unsupported record_type %q", s.RecordType)
+	}
+	s.resolver = net.DefaultResolver
+	if s.Resolver != "" {
+		addr := s.Resolver
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		s.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return nil
+}
+
+func (o *Opt) lookupDNS(ctx context.Context, service *Service) ([]string, error) {
+	r := service.resolver
+	name := service.Query
+	if service.RecordType != "PTR" && !strings.HasSuffix(name, ".") {
+		// 検索ドメインを付与させないために絶対名で問い合わせる
+		name += "."
+	}
+	answers := []string{}
+	switch service.RecordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if service.RecordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "NS":
+		nss, err := r.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			answers = append(answers, ns.Host)
+		}
+	case "TXT":
+		txts, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, txts...)
+	case "SRV":
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target))
+		}
+	case "PTR":
+		names, err := r.LookupAddr(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, names...)
+	}
+	return answers, nil
+}
+
+// sameDNSAnswer compares answers ignoring case and the trailing dot of names
+func sameDNSAnswer(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+func (o *Opt) execDNSCheck(ctx context.Context, service *Service) (int, string, error) {
+	if !service.Timeout.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.Timeout.Duration)
+		defer cancel()
+	}
+	target := service.RecordType + " " + service.Query
+	if service.Resolver != "" {
+		target += " @" + service.Resolver
+	}
+	start := time.Now()
+	answers, err := o.lookupDNS(ctx, service)
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		return CheckCritical, fmt.Sprintf("lookup %s failed: %v", target, err), nil
+	}
+	if len(answers) == 0 {
+		return CheckCritical, fmt.Sprintf("%s in %s: no answer", target, latency), nil
+	}
+	summary := fmt.Sprintf("%s in %s: %s", target, latency, strings.Join(answers, ", "))
+	for _, expected := range service.Expected {
+		found := slices.ContainsFunc(answers, func(answer string) bool {
+			return sameDNSAnswer(answer, expected)
+		})
+		if !found {
+			return CheckCritical, fmt.Sprintf("%s: expected answer %q not found", summary, expected), nil
+		}
+	}
+	return CheckOK, summary, nil
+}
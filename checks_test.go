@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newHTTPCheckService(t *testing.T, s *Service) *Service {
+	t.Helper()
+	s.Type = "http"
+	if err := s.prepareHTTPCheck(); err != nil {
+		t.Fatalf("prepareHTTPCheck failed: %v", err)
+	}
+	return s
+}
+
+func TestExecHTTPCheck(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			if r.Header.Get("X-Check") != "yes" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, "status: healthy version=1.2.3")
+		case "/error":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	opt := newTestOpt(t)
+	cases := []struct {
+		name    string
+		service *Service
+		status  int
+		message string
+	}{
+		{
+			name:    "ok",
+			service: &Service{URL: ts.URL + "/ok", Headers: map[string]string{"X-Check": "yes"}},
+			status:  CheckOK,
+			message: "HTTP 200 OK",
+		},
+		{
+			name:    "missing header",
+			service: &Service{URL: ts.URL + "/ok"},
+			status:  CheckCritical,
+			message: "unexpected status code",
+		},
+		{
+			name:    "expected status",
+			service: &Service{URL: ts.URL + "/error", ExpectedStatus: []int{503}},
+			status:  CheckOK,
+			message: "HTTP 503",
+		},
+		{
+			name:    "unexpected status",
+			service: &Service{URL: ts.URL + "/error"},
+			status:  CheckCritical,
+			message: "HTTP 503 Service Unavailable",
+		},
+		{
+			name:    "body contains",
+			service: &Service{URL: ts.URL + "/ok", Headers: map[string]string{"X-Check": "yes"}, BodyContains: "unhealthy"},
+			status:  CheckCritical,
+			message: `body does not contain "unhealthy"`,
+		},
+		{
+			name:    "body regexp",
+			service: &Service{URL: ts.URL + "/ok", Headers: map[string]string{"X-Check": "yes"}, BodyRegexp: `version=\d+\.\d+`},
+			status:  CheckOK,
+			message: "HTTP 200 OK",
+		},
+		{
+			name:    "connection refused",
+			service: &Service{URL: "http://127.0.0.1:1/"},
+			status:  CheckCritical,
+			message: "GET http://127.0.0.1:1/ failed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service := newHTTPCheckService(t, c.service)
+			status, message, err := opt.execServiceCheck(context.Background(), service)
+			if err != nil {
+				t.Fatalf("execServiceCheck failed: %v", err)
+			}
+			if status != c.status {
+				t.Errorf("status = %d, want %d (%s)", status, c.status, message)
+			}
+			if !strings.Contains(message, c.message) {
+				t.Errorf("message = %q, want contains %q", message, c.message)
+			}
+		})
+	}
+}
+
+func TestExecHTTPCheck_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	opt := newTestOpt(t)
+	service := newHTTPCheckService(t, &Service{URL: ts.URL})
+	status, message, _ := opt.execServiceCheck(context.Background(), service)
+	if status != CheckCritical {
+		t.Errorf("status = %d, want %d for untrusted certificate (%s)", status, CheckCritical, message)
+	}
+
+	service = newHTTPCheckService(t, &Service{URL: ts.URL, TLSSkipVerify: true})
+	status, message, _ = opt.execServiceCheck(context.Background(), service)
+	if status != CheckOK {
+		t.Errorf("status = %d, want %d with tls_skip_verify (%s)", status, CheckOK, message)
+	}
+}
+
+func TestExecTCPCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	opt := newTestOpt(t)
+	service := &Service{Type: "tcp", Address: addr}
+	if err := service.prepareTCPCheck(); err != nil {
+		t.Fatalf("prepareTCPCheck failed: %v", err)
+	}
+	status, message, err := opt.execServiceCheck(context.Background(), service)
+	if err != nil || status != CheckOK {
+		t.Errorf("status = %d, err = %v, want %d (%s)", status, err, CheckOK, message)
+	}
+
+	ln.Close()
+	status, message, _ = opt.execServiceCheck(context.Background(), service)
+	if status != CheckCritical {
+		t.Errorf("status = %d, want %d after listener closed (%s)", status, CheckCritical, message)
+	}
+}
+
+func TestExecTLSCheck(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := newTestOpt(t)
+	cases := []struct {
+		name    string
+		service *Service
+		status  int
+		message string
+	}{
+		{
+			name:    "untrusted",
+			service: &Service{Address: addr},
+			status:  CheckCritical,
+			message: "TLS handshake with " + addr + " failed",
+		},
+		{
+			name:    "trusted by ca file",
+			service: &Service{Address: addr, TLSCAFile: caFile},
+			status:  CheckOK,
+			message: "days left",
+		},
+		{
+			name:    "expires within warning window",
+			service: &Service{Address: addr, TLSSkipVerify: true, CertExpiryWarning: MustDuration("1000000h")},
+			status:  CheckWarning,
+			message: "certificate expires within 1000000h",
+		},
+		{
+			name:    "expires within critical window",
+			service: &Service{Address: addr, TLSSkipVerify: true, CertExpiryCritical: MustDuration("1000000h")},
+			status:  CheckCritical,
+			message: "certificate expires within 1000000h",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service := c.service
+			service.Type = "tls"
+			if err := service.prepareTLSCheck(); err != nil {
+				t.Fatalf("prepareTLSCheck failed: %v", err)
+			}
+			status, message, err := opt.execServiceCheck(context.Background(), service)
+			if err != nil {
+				t.Fatalf("execServiceCheck failed: %v", err)
+			}
+			if status != c.status {
+				t.Errorf("status = %d, want %d (%s)", status, c.status, message)
+			}
+			if !strings.Contains(message, c.message) {
+				t.Errorf("message = %q, want contains %q", message, c.message)
+			}
+		})
+	}
+}
+
+// startTestDNSServer answers A queries from records and NXDOMAIN otherwise
+func startTestDNSServer(t *testing.T, records map[string][]net.IP) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			// header(12) + qname + qtype(2) + qclass(2)
+			labels := []string{}
+			i := 12
+			for i < n && req[i] != 0 {
+				l := int(req[i])
+				labels = append(labels, string(req[i+1:i+1+l]))
+				i += 1 + l
+			}
+			question := req[12 : i+5]
+			qtype := binary.BigEndian.Uint16(req[i+1 : i+3])
+			name := strings.ToLower(strings.Join(labels, "."))
+
+			answers := [][]byte{}
+			ips, ok := records[name]
+			if qtype == 1 {
+				for _, ip := range ips {
+					rr := []byte{0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4}
+					answers = append(answers, append(rr, ip.To4()...))
+				}
+			}
+			res := make([]byte, 12)
+			copy(res, req[:2])
+			flags := uint16(0x8180)
+			if !ok {
+				flags |= 3 // NXDOMAIN
+			}
+			binary.BigEndian.PutUint16(res[2:], flags)
+			binary.BigEndian.PutUint16(res[4:], 1)
+			binary.BigEndian.PutUint16(res[6:], uint16(len(answers)))
+			res = append(res, question...)
+			for _, a := range answers {
+				res = append(res, a...)
+			}
+			pc.WriteTo(res, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestExecDNSCheck(t *testing.T) {
+	resolver := startTestDNSServer(t, map[string][]net.IP{
+		"www.example.test": {net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")},
+	})
+
+	opt := newTestOpt(t)
+	cases := []struct {
+		name    string
+		service *Service
+		status  int
+		message string
+	}{
+		{
+			name:    "resolved",
+			service: &Service{Query: "www.example.test", Resolver: resolver},
+			status:  CheckOK,
+			message: "192.0.2.1, 192.0.2.2",
+		},
+		{
+			name:    "expected answer",
+			service: &Service{Query: "www.example.test", Resolver: resolver, Expected: []string{"192.0.2.2"}},
+			status:  CheckOK,
+			message: "A www.example.test @" + resolver,
+		},
+		{
+			name:    "unexpected answer",
+			service: &Service{Query: "www.example.test", Resolver: resolver, Expected: []string{"192.0.2.3"}},
+			status:  CheckCritical,
+			message: `expected answer "192.0.2.3" not found`,
+		},
+		{
+			name:    "nxdomain",
+			service: &Service{Query: "missing.example.test", Resolver: resolver},
+			status:  CheckCritical,
+			message: "lookup A missing.example.test @" + resolver + " failed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service := c.service
+			service.Type = "dns"
+			service.Timeout = MustDuration("2s")
+			if err := service.prepareDNSCheck(); err != nil {
+				t.Fatalf("prepareDNSCheck failed: %v", err)
+			}
+			status, message, err := opt.execServiceCheck(context.Background(), service)
+			if err != nil {
+				t.Fatalf("execServiceCheck failed: %v", err)
+			}
+			if status != c.status {
+				t.Errorf("status = %d, want %d (%s)", status, c.status, message)
+			}
+			if !strings.Contains(message, c.message) {
+				t.Errorf("message = %q, want contains %q", message, c.message)
+			}
+		})
+	}
+}
+
+func TestLoadToml_HTTPCheck(t *testing.T) {
+	tomlContent := `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "Top"
+  type = "http"
+  url = "https://example.com/"
+  method = "head"
+  expected_status = [200, 301]
+  body_regexp = "ok"
+  timeout = "5s"
+`
+	path := writeTempToml(t, tomlContent)
+	conf, err := loadToml(path)
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	svc := conf.Categories[0].Services[0]
+	if svc.Method != http.MethodHead {
+		t.Errorf("Method = %q, want %q", svc.Method, http.MethodHead)
+	}
+	if svc.bodyRegexp == nil || svc.httpClient == nil {
+		t.Errorf("http check is not prepared")
+	}
+	if !svc.expectedStatusCode(301) || svc.expectedStatusCode(302) {
+		t.Errorf("expected_status is not applied: %v", svc.ExpectedStatus)
+	}
+}
+
+func TestLoadToml_InvalidCheck(t *testing.T) {
+	cases := map[string]string{
+		"missing url": `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "Top"
+  type = "http"
+`,
+		"invalid regexp": `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "Top"
+  type = "http"
+  url = "https://example.com/"
+  body_regexp = "("
+`,
+		"tcp without port": `
+[[category]]
+name = "Net"
+  [[category.service]]
+  name = "SSH"
+  type = "tcp"
+  address = "example.com"
+`,
+		"unsupported record type": `
+[[category]]
+name = "Net"
+  [[category.service]]
+  name = "DNS"
+  type = "dns"
+  query = "example.com"
+  record_type = "HINFO"
+`,
+		"unknown type": `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "Top"
+  type = "gopher"
+`,
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeTempToml(t, content)
+			if _, err := loadToml(path); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// logEntry aggregates the logs of a day written with the same service id, category, name and command
+type logEntry struct {
+	ServiceID    string
+	CategoryName string
+	Name         string
+	Command      []string
+	// number of results by exit code
+	codes map[int]int
+	// non-zero results with the time, to apply maintenance windows
+	failures []logSample
+	// check durations in seconds. kept only for the days in the latency window
+	durations []float64
+	// all results with the time, to calculate the latest status. kept only for today
+	samples []logSample
+	// results with the exit code different from the previous one, for the feeds.
+	// only available for the days read from the raw logs
+	changes []logChange
+}
+
+type logSample struct {
+	time time.Time
+	code int
+}
+
+// logChange is a result where the status of the service may change
+type logChange struct {
+	logSample
+	message string
+}
+
+// daySummary is the aggregate of a daily log file
+type daySummary struct {
+	entries map[string]*logEntry
+	// time of the last log
+	lastUpdated time.Time
+	// entries of each service of conf, built by mapServices. cleared when an entry is added
+	conf      *Config
+	byService map[*Service][]*logEntry
+}
+
+// dailySummaryJSON is the format of the summary kept after the raw logs are removed.
+// the durations are not kept, since only the recent days in the latency window use them
+type dailySummaryJSON struct {
+	LastUpdated time.Time          `json:"last_updated"`
+	Entries     []*logEntrySummary `json:"entries"`
+}
+
+type logEntrySummary struct {
+	ServiceID    string      `json:"service_id,omitempty"`
+	CategoryName string      `json:"category_name"`
+	Name         string      `json:"name"`
+	Command      []string    `json:"command"`
+	Codes        map[int]int `json:"codes"`
+	Failures     [][2]int64  `json:"failures"`
+}
+
+func (d *daySummary) MarshalJSON() ([]byte, error) {
+	s := &dailySummaryJSON{LastUpdated: d.lastUpdated, Entries: []*logEntrySummary{}}
+	for _, e := range d.entries {
+		failures := make([][2]int64, len(e.failures))
+		for i, f := range e.failures {
+			failures[i] = [2]int64{f.time.Unix(), int64(f.code)}
+		}
+		s.Entries = append(s.Entries, &logEntrySummary{
+			ServiceID:    e.ServiceID,
+			CategoryName: e.CategoryName,
+			Name:         e.Name,
+			Command:      e.Command,
+			Codes:        e.codes,
+			Failures:     failures,
+		})
+	}
+	return json.Marshal(s)
+}
+
+func (d *daySummary) UnmarshalJSON(b []byte) error {
+	s := &dailySummaryJSON{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	d.lastUpdated = s.LastUpdated
+	d.entries = map[string]*logEntry{}
+	for _, es := range s.Entries {
+		e := &logEntry{
+			ServiceID:    es.ServiceID,
+			CategoryName: es.CategoryName,
+			Name:         es.Name,
+			Command:      es.Command,
+			codes:        es.Codes,
+		}
+		if e.codes == nil {
+			e.codes = map[int]int{}
+		}
+		for _, f := range es.Failures {
+			e.failures = append(e.failures, logSample{time: time.Unix(f[0], 0), code: int(f[1])})
+		}
+		d.entries[e.key()] = e
+	}
+	return nil
+}
+
+func logEntryKey(serviceID, categoryName, name string, command []string) string {
+	return serviceID + "\x00" + categoryName + "\x00" + name + "\x00" + strings.Join(command, "\x00")
+}
+
+func (e *logEntry) key() string {
+	return logEntryKey(e.ServiceID, e.CategoryName, e.Name, e.Command)
+}
+
+func summarizeLogs(logs []*ServiceLog, lastUpdated time.Time) *daySummary {
+	d := &daySummary{entries: map[string]*logEntry{}, lastUpdated: lastUpdated}
+	for _, log := range logs {
+		d.add(log)
+	}
+	return d
+}
+
+func (d *daySummary) add(log *ServiceLog) {
+	key := logEntryKey(log.ServiceID, log.CategoryName, log.Name, log.Command)
+	e, ok := d.entries[key]
+	if !ok {
+		e = &logEntry{
+			ServiceID:    log.ServiceID,
+			CategoryName: log.CategoryName,
+			Name:         log.Name,
+			Command:      log.Command,
+			codes:        map[int]int{},
+		}
+		d.entries[key] = e
+		d.byService = nil
+	}
+	e.codes[log.Status]++
+	if log.Status != 0 {
+		e.failures = append(e.failures, logSample{time: log.Time, code: log.Status})
+	}
+	if log.Duration > 0 {
+		e.durations = append(e.durations, log.Duration)
+	}
+	e.samples = append(e.samples, logSample{time: log.Time, code: log.Status})
+	if n := len(e.changes); n == 0 || e.changes[n-1].code != log.Status {
+		e.changes = append(e.changes, logChange{logSample: logSample{time: log.Time, code: log.Status}, message: log.Message})
+	}
+	d.lastUpdated = log.Time
+}
+
+// merge adds the results of o written with the same key
+func (e *logEntry) merge(o *logEntry) {
+	for code, n := range o.codes {
+		e.codes[code] += n
+	}
+	e.failures = append(e.failures, o.failures...)
+	e.durations = append(e.durations, o.durations...)
+	e.samples = append(e.samples, o.samples...)
+	e.changes = append(e.changes, o.changes...)
+}
+
+// compact drops what is not needed for the day age days ago:
+// the samples for past days and the durations out of the latency window
+func (d *daySummary) compact(age int) {
+	for _, e := range d.entries {
+		if age > 0 {
+			e.samples = nil
+		}
+		if age >= latencyDays {
+			e.durations = nil
+		}
+	}
+}
+
+// mapServices finds the entries of each service of conf, so that the services are counted without scanning all entries.
+// the mapping is kept until the configuration is changed or a new entry is added
+func (d *daySummary) mapServices(conf *Config) {
+	if d.byService != nil && d.conf == conf {
+		return
+	}
+	byID := map[string][]*Service{}
+	byName := map[string][]*Service{}
+	byCommand := map[string][]*Service{}
+	d.conf = conf
+	d.byService = map[*Service][]*logEntry{}
+	for _, category := range conf.Categories {
+		for _, service := range category.Services {
+			d.byService[service] = nil
+			if service.ID != "" {
+				byID[service.ID] = append(byID[service.ID], service)
+			}
+			key := logEntryKey("", service.categoryName, service.Name, nil)
+			byName[key] = append(byName[key], service)
+			if len(service.Command) > 0 {
+				key := strings.Join(service.Command, "\x00")
+				byCommand[key] = append(byCommand[key], service)
+			}
+		}
+	}
+	for _, e := range d.entries {
+		// Service.matches と同じ条件で引く
+		if e.ServiceID != "" {
+			for _, service := range byID[e.ServiceID] {
+				d.byService[service] = append(d.byService[service], e)
+			}
+			continue
+		}
+		services := byName[logEntryKey("", e.CategoryName, e.Name, nil)]
+		if len(e.Command) > 0 {
+			services = append(slices.Clone(services), byCommand[strings.Join(e.Command, "\x00")]...)
+		}
+		for i, service := range services {
+			if !slices.Contains(services[:i], service) {
+				d.byService[service] = append(d.byService[service], e)
+			}
+		}
+	}
+}
+
+// serviceEntries returns the entries of the service. the entries are scanned unless the service is mapped by mapServices
+func (d *daySummary) serviceEntries(service *Service) []*logEntry {
+	if entries, ok := d.byService[service]; ok {
+		return entries
+	}
+	entries := []*logEntry{}
+	for _, e := range d.entries {
+		if service.matches(e.ServiceID, e.CategoryName, e.Name, e.Command) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// count returns the number of results of the service by status.
+// windows are the maintenance windows affecting the service
+func (d *daySummary) count(service *Service, windows []*Maintenance) *statusCount {
+	count := &statusCount{}
+	for _, e := range d.serviceEntries(service) {
+		// 終了コード0の結果は時刻を持たないので、メンテナンス期間は適用しない
+		count.addN(service.statusByCode(0), e.codes[0])
+		for _, f := range e.failures {
+			count.add(service.statusIn(f.code, f.time, windows))
+		}
+	}
+	return count
+}
+
+// countSince is count limited to the results after since. only available for today
+func (d *daySummary) countSince(service *Service, windows []*Maintenance, since time.Time) *statusCount {
+	count := &statusCount{}
+	for _, e := range d.serviceEntries(service) {
+		for _, s := range e.samples {
+			if !s.time.Before(since) {
+				count.add(service.statusIn(s.code, s.time, windows))
+			}
+		}
+	}
+	return count
+}
+
+func (d *daySummary) durations(service *Service) []float64 {
+	durations := []float64{}
+	for _, e := range d.serviceEntries(service) {
+		durations = append(durations, e.durations...)
+	}
+	return durations
+}
+
+// logIndex keeps the aggregates of daily logs in memory.
+// a day is read from the storage when it is needed for the first time, and updated by append after that.
+// the zero value is ready to use
+type logIndex struct {
+	mu   sync.Mutex
+	days map[string]*daySummary
+	// days already read from the storage, including days without logs
+	loaded map[string]bool
+}
+
+// loadDay reads the logs of the day unless it has been loaded. must be called with the lock held
+func (x *logIndex) loadDay(store logStore, day string) {
+	if x.loaded[day] {
+		return
+	}
+	if x.days == nil {
+		x.days = map[string]*daySummary{}
+		x.loaded = map[string]bool{}
+	}
+	x.loaded[day] = true
+	logs, err := store.readDay(day)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("failed to loadlog", slog.Any("error", err))
+		return
+	}
+	if len(logs) > 0 {
+		x.days[day] = summarizeLogs(logs, time.Now())
+		return
+	}
+	// 保存期間を過ぎて生のログを削除した日は要約を読む
+	summary, err := store.readSummary(day)
+	if err != nil {
+		slog.Warn("failed to load summary", slog.Any("error", err))
+		return
+	}
+	if summary != nil {
+		x.days[day] = summary
+	}
+}
+
+// append writes the log to the storage and adds it to the index
+func (x *logIndex) append(store logStore, log *ServiceLog) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	day := dayOf(log.Time)
+	if err := store.append(log); err != nil {
+		return err
+	}
+	if !x.loaded[day] {
+		// ストレージから読むと今回のログも含まれる
+		x.loadDay(store, day)
+		return nil
+	}
+	summary, ok := x.days[day]
+	if !ok {
+		summary = summarizeLogs(nil, log.Time)
+		x.days[day] = summary
+	}
+	summary.add(log)
+	return nil
+}
+
+// view calls f with the summaries of n days from today to the past. days without logs are nil.
+// days out of the range are removed from the index
+func (x *logIndex) view(store logStore, today time.Time, n int, f func(days []*daySummary)) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	summaries, keep := x.summaries(store, today, n)
+	for day := range x.loaded {
+		if !keep[day] {
+			delete(x.loaded, day)
+			delete(x.days, day)
+		}
+	}
+	f(summaries)
+}
+
+// peek is view without removing the other days, for the readers of the recent days
+func (x *logIndex) peek(store logStore, today time.Time, n int, f func(days []*daySummary)) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	summaries, _ := x.summaries(store, today, n)
+	f(summaries)
+}
+
+// summaries loads n days from today to the past, and returns them with the set of the days.
+// must be called with the lock held
+func (x *logIndex) summaries(store logStore, today time.Time, n int) ([]*daySummary, map[string]bool) {
+	summaries := make([]*daySummary, n)
+	days := map[string]bool{}
+	d := today
+	for i := 0; i < n; i++ {
+		day := dayOf(d)
+		days[day] = true
+		x.loadDay(store, day)
+		summaries[i] = x.days[day]
+		if summaries[i] != nil {
+			summaries[i].compact(i)
+		}
+		d = d.AddDate(0, 0, -1)
+	}
+	return summaries, days
+}
+
+// maintain calls f with the lock held, so that the logs are not written while f modifies the storage
+func (x *logIndex) maintain(f func() error) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return f()
+}
+
+// forget removes the day from the index to read it from the storage again. must be called with the lock held
+func (x *logIndex) forget(day string) {
+	delete(x.loaded, day)
+	delete(x.days, day)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadToml_HistoryDays(t *testing.T) {
+	base := `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`
+	conf, err := loadToml(writeTempToml(t, base))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	if conf.HistoryDays != 7 || conf.UseTimeline() {
+		t.Errorf("HistoryDays = %d, UseTimeline = %v, want 7, false", conf.HistoryDays, conf.UseTimeline())
+	}
+
+	conf, err = loadToml(writeTempToml(t, "history_days = 30\n"+base))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	if conf.HistoryDays != 30 || !conf.UseTimeline() {
+		t.Errorf("HistoryDays = %d, UseTimeline = %v, want 30, true", conf.HistoryDays, conf.UseTimeline())
+	}
+
+	_, err = loadToml(writeTempToml(t, "history_days = 400\n"+base))
+	if err == nil || !strings.Contains(err.Error(), "history_days") {
+		t.Errorf("loadToml should fail with too long history_days: %v", err)
+	}
+}
+
+func TestLoadLog_HistoryDays(t *testing.T) {
+	opt := newTestOpt(t)
+	opt.config.HistoryDays = 30
+	svc := opt.config.Categories[0].Services[0]
+	old := time.Now().AddDate(0, 0, -20)
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: old, Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 2},
+	}, old.Format("20060102"))
+
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	if len(svc.StatusHistory) != 30 || len(opt.config.Days) != 31 {
+		t.Fatalf("len(StatusHistory) = %d, len(Days) = %d, want 30, 31", len(svc.StatusHistory), len(opt.config.Days))
+	}
+	if svc.StatusHistory[20] != Outage {
+		t.Errorf("StatusHistory[20] = %v, want Outage", svc.StatusHistory[20])
+	}
+	// タイムラインは古い日から並ぶ
+	if len(svc.Timeline) != 30 || svc.Timeline[9].Status != Outage || svc.Timeline[9].Date != old.Format("2006-01-02") {
+		t.Errorf("Timeline[9] = %+v, want Outage at %s", svc.Timeline[9], old.Format("2006-01-02"))
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte(`class="timeline"`)) || !bytes.Contains(opt.htmlBlob, []byte("30 days")) {
+		t.Errorf("htmlBlob does not contain the timeline")
+	}
+}
+
+func TestLogIndex(t *testing.T) {
+	opt := newTestOpt(t)
+	svc := opt.config.Categories[0].Services[0]
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	command := []string{"ping", "google.com"}
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: yesterday, Name: "Google", CategoryName: "Web", Command: command, Status: 0},
+	}, yesterday.Format("20060102"))
+
+	counts := func() (int, int) {
+		var today, past int
+		opt.index.view(opt.logStore(), now, 7, func(days []*daySummary) {
+			if days[0] != nil {
+				today = days[0].count(svc, nil).operational
+			}
+			if days[1] != nil {
+				past = days[1].count(svc, nil).operational
+			}
+		})
+		return today, past
+	}
+	if today, past := counts(); today != 0 || past != 1 {
+		t.Errorf("counts = %d, %d, want 0, 1", today, past)
+	}
+
+	// 読み込み済みの日は追記したログだけを反映し、ファイルを読み直さない
+	if err := opt.appendServiceLog(&ServiceLog{Time: now, Name: "Google", CategoryName: "Web", Command: command, Status: 0}); err != nil {
+		t.Fatal(err)
+	}
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: yesterday, Name: "Google", CategoryName: "Web", Command: command, Status: 0},
+	}, yesterday.Format("20060102"))
+	if today, past := counts(); today != 1 || past != 1 {
+		t.Errorf("counts = %d, %d, want 1, 1", today, past)
+	}
+
+	// 範囲外の日は削除する
+	opt.index.view(opt.logStore(), now, 1, func([]*daySummary) {})
+	if _, ok := opt.index.days[yesterday.Format("20060102")]; ok {
+		t.Errorf("summary out of the range should be removed")
+	}
+}
+
+func TestDaySummary_MapServices(t *testing.T) {
+	conf, err := loadToml(writeTempToml(t, `
+[[category]]
+name = "Web"
+  [[category.service]]
+  id = "api"
+  name = "API"
+  command = ["true", "api"]
+  [[category.service]]
+  name = "Google"
+  command = ["true", "google.com"]
+  [[category.service]]
+  name = "Batch"
+  command = ["true"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := []*ServiceLog{
+		{ServiceID: "api", Name: "Renamed", CategoryName: "Web", Status: 0},
+		// IDを持つログは名前が同じでもIDの違うサービスには数えない
+		{ServiceID: "old", Name: "API", CategoryName: "Web", Status: 0},
+		{Name: "Google", CategoryName: "Web", Command: []string{"true", "google.com"}, Status: 1},
+		// 名前を変えてもコマンドが同じなら数える
+		{Name: "Old Google", CategoryName: "Web", Command: []string{"true", "google.com"}, Status: 0},
+		{Name: "Batch", CategoryName: "Web", Command: []string{"true", "google.com"}, Status: 0},
+	}
+	summary := summarizeLogs(logs, time.Now())
+	scanned := map[*Service]int{}
+	for _, service := range conf.Categories[0].Services {
+		scanned[service] = summary.count(service, nil).total()
+	}
+	summary.mapServices(conf)
+	for service, n := range scanned {
+		if got := summary.count(service, nil).total(); got != n {
+			t.Errorf("count of %s = %d, want %d", service.Name, got, n)
+		}
+	}
+	if n := scanned[conf.Categories[0].Services[1]]; n != 3 {
+		t.Errorf("count of Google = %d, want 3", n)
+	}
+
+	// 新しいエントリが増えたら引き直す
+	batch := conf.Categories[0].Services[2]
+	summary.add(&ServiceLog{Name: "Batch", CategoryName: "Web", Status: 0})
+	summary.mapServices(conf)
+	if n := summary.count(batch, nil).total(); n != 2 {
+		t.Errorf("count of Batch after add = %d, want 2", n)
+	}
+	// 設定が変われば引き直す
+	reloaded, err := loadToml(writeTempToml(t, "[[category]]\nname = \"Web\"\n  [[category.service]]\n  name = \"Batch\"\n  command = [\"true\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary.mapServices(reloaded)
+	if _, ok := summary.byService[batch]; ok {
+		t.Errorf("services of the old configuration should not be mapped")
+	}
+	if n := summary.count(reloaded.Categories[0].Services[0], nil).total(); n != 2 {
+		t.Errorf("count of Batch after reload = %d, want 2", n)
+	}
+}
+
+func TestDaySummary_Durations(t *testing.T) {
+	service := &Service{Name: "Google", categoryName: "Web"}
+	now := time.Now()
+	logs := []*ServiceLog{
+		{Time: now, Name: "Google", CategoryName: "Web", Status: 0, Duration: 0.01},
+		{Time: now, Name: "Google", CategoryName: "Web", Status: 2, Duration: 0.5},
+	}
+	summary := summarizeLogs(logs, now)
+	summary.compact(latencyDays - 1)
+	if d := summary.durations(service); len(d) != 2 {
+		t.Errorf("durations in the latency window = %v, want 2", d)
+	}
+	summary.compact(latencyDays)
+	if d := summary.durations(service); len(d) != 0 {
+		t.Errorf("durations out of the latency window = %v, want none", d)
+	}
+
+	// 集計には応答時間を残さず、件数と失敗した時刻は残す
+	b, err := summarizeLogs(logs, now).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("durations")) {
+		t.Errorf("summary should not contain the durations: %s", b)
+	}
+	decoded := &daySummary{}
+	if err := decoded.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	if count := decoded.count(service, nil); count.operational != 1 || count.outage != 1 {
+		t.Errorf("count of the summary = %+v", count)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	defaultChecksPerPage = 50
+	maxChecksPerPage     = 500
+	// maxQueryDays is the longest range of the check results in a request
+	maxQueryDays = 90
+)
+
+// DetailPath is the path of the page listing the check results of the service
+func (s *Service) DetailPath() string {
+	return "/services/" + url.PathEscape(s.categoryName) + "/" + url.PathEscape(s.Name)
+}
+
+// checkResult is a check result shown in the drill-down
+type checkResult struct {
+	Time     time.Time   `json:"time"`
+	ExitCode int         `json:"exit_code"`
+	Status   *statusText `json:"status"`
+	Duration float64     `json:"duration"`
+	Output   string      `json:"output,omitempty"`
+}
+
+// DurationText formats the duration for the page. logs written by old versions have no duration
+func (r *checkResult) DurationText() string {
+	if r.Duration == 0 {
+		return "-"
+	}
+	return time.Duration(r.Duration * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// serviceChecks is a page of the check results of a service, newest first
+type serviceChecks struct {
+	Category     string         `json:"category"`
+	Name         string         `json:"name"`
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	Page         int            `json:"page"`
+	PerPage      int            `json:"per_page"`
+	Total        int            `json:"total"`
+	OutputHidden bool           `json:"output_hidden"`
+	Checks       []*checkResult `json:"checks"`
+	// for the html page
+	Config  *Config  `json:"-"`
+	Service *Service `json:"-"`
+}
+
+func (s *serviceChecks) HasPrev() bool {
+	return s.Page > 1
+}
+
+func (s *serviceChecks) HasNext() bool {
+	return s.Page*s.PerPage < s.Total
+}
+
+func (s *serviceChecks) PrevURL() string {
+	return s.pageURL(s.Page - 1)
+}
+
+func (s *serviceChecks) NextURL() string {
+	return s.pageURL(s.Page + 1)
+}
+
+// pageURL returns the url of the page with the same range
+func (s *serviceChecks) pageURL(page int) string {
+	q := url.Values{}
+	q.Set("from", s.From.Format(time.RFC3339))
+	q.Set("to", s.To.Format(time.RFC3339))
+	q.Set("page", strconv.Itoa(page))
+	if s.PerPage != defaultChecksPerPage {
+		q.Set("per_page", strconv.Itoa(s.PerPage))
+	}
+	return s.Service.DetailPath() + "?" + q.Encode()
+}
+
+// parseTimeParam parses RFC3339 or a date (YYYY-MM-DD) in the local time
+func parseTimeParam(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+func parseIntParam(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return n, nil
+}
+
+// findService returns the service in the category. must be called with the read lock held
+func (c *Config) findService(categoryName, name string) *Service {
+	for _, category := range c.Categories {
+		if category.Name != categoryName {
+			continue
+		}
+		for _, service := range category.Services {
+			if service.Name == name {
+				return service
+			}
+		}
+	}
+	return nil
+}
+
+// pathParam returns the decoded path parameter.
+// echo matches the escaped path only when the request has a RawPath (e.g. %2F in a name), and the decoded path otherwise
+func pathParam(c *echo.Context, name string) (string, error) {
+	if c.Request().URL.RawPath == "" {
+		return c.Param(name), nil
+	}
+	return url.PathUnescape(c.Param(name))
+}
+
+// loadServiceChecks queries the check results of the service for the request
+func (o *Opt) loadServiceChecks(c *echo.Context) (*serviceChecks, error) {
+	categoryName, err := pathParam(c, "category")
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "service not found")
+	}
+	name, err := pathParam(c, "name")
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "service not found")
+	}
+	o.rwlock.RLock()
+	service := o.config.findService(categoryName, name)
+	o.rwlock.RUnlock()
+	if service == nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "service not found")
+	}
+
+	now := time.Now()
+	to, err := parseTimeParam(c.QueryParam("to"), now)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid to").Wrap(err)
+	}
+	// デフォルトは直近24時間
+	from, err := parseTimeParam(c.QueryParam("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid from").Wrap(err)
+	}
+	if !from.Before(to) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	if to.Sub(from) > maxQueryDays*24*time.Hour {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("range must be at most %d days", maxQueryDays))
+	}
+	page, err := parseIntParam(c.QueryParam("page"), 1)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid page").Wrap(err)
+	}
+	perPage, err := parseIntParam(c.QueryParam("per_page"), defaultChecksPerPage)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid per_page").Wrap(err)
+	}
+	perPage = min(perPage, maxChecksPerPage)
+
+	logs, err := o.logStore().query(service.ID, categoryName, name, from, to)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(logs)
+
+	o.rwlock.RLock()
+	defer o.rwlock.RUnlock()
+	checks := &serviceChecks{
+		Category:     categoryName,
+		Name:         name,
+		From:         from,
+		To:           to,
+		Page:         page,
+		PerPage:      perPage,
+		Total:        len(logs),
+		OutputHidden: service.HideOutput,
+		Checks:       []*checkResult{},
+		Config:       o.config,
+		Service:      service,
+	}
+	start := min((page-1)*perPage, len(logs))
+	for _, log := range logs[start:min(start+perPage, len(logs))] {
+		check := &checkResult{
+			Time:     log.Time,
+			ExitCode: log.Status,
+			Status:   service.statusOf(log.Status, log.Time),
+			Duration: log.Duration,
+		}
+		if !service.HideOutput {
+			check.Output = log.Message
+		}
+		checks.Checks = append(checks.Checks, check)
+	}
+	return checks, nil
+}
+
+func (o *Opt) handleServiceJSON(c *echo.Context) error {
+	checks, err := o.loadServiceChecks(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, checks)
+}
+
+func (o *Opt) handleServicePage(c *echo.Context) error {
+	checks, err := o.loadServiceChecks(c)
+	if err != nil {
+		return err
+	}
+	w := &bytes.Buffer{}
+	o.rwlock.RLock()
+	err = o.config.template(o.config.negotiateLanguage(c.Request())).ExecuteTemplate(w, "service", checks)
+	o.rwlock.RUnlock()
+	if err != nil {
+		return err
+	}
+	return c.HTMLBlob(http.StatusOK, w.Bytes())
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+func TestServiceChecks(t *testing.T) {
+	opt := newTestOpt(t)
+	svc := opt.config.Categories[0].Services[0]
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := opt.appendServiceLog(&ServiceLog{
+			Time: now.Add(time.Duration(i-5) * time.Minute), Name: "Google", CategoryName: "Web", Command: svc.Command,
+			Status: i % 2 * 2, Message: "<b>output</b>", Duration: 0.25,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e := opt.buildHandler()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/_json/services/Web/Google?per_page=2&page=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var res struct {
+		Total  int `json:"total"`
+		Checks []struct {
+			ExitCode int     `json:"exit_code"`
+			Status   string  `json:"status"`
+			Duration float64 `json:"duration"`
+			Output   string  `json:"output"`
+		} `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// 新しい順に3件目から
+	if res.Total != 5 || len(res.Checks) != 2 || res.Checks[0].ExitCode != 0 ||
+		res.Checks[1].ExitCode != 2 || res.Checks[1].Status != "Outage" || res.Checks[0].Duration != 0.25 || res.Checks[0].Output != "<b>output</b>" {
+		t.Errorf("response = %s", rec.Body.String())
+	}
+
+	from := url.QueryEscape(now.Add(-150 * time.Second).Format(time.RFC3339))
+	if rec := get("/_json/services/Web/Google?from=" + from); !strings.Contains(rec.Body.String(), `"total":2`) {
+		t.Errorf("response with from = %s", rec.Body.String())
+	}
+	for path, want := range map[string]int{
+		"/_json/services/Web/Unknown":                              http.StatusNotFound,
+		"/_json/services/Web/Google?page=0":                        http.StatusBadRequest,
+		"/_json/services/Web/Google?from=x":                        http.StatusBadRequest,
+		"/_json/services/Web/Google?from=0001-01-01":               http.StatusBadRequest,
+		"/_json/services/Web/Google?from=2026-01-01&to=9999-12-31": http.StatusBadRequest,
+		"/services/Web/Google":                                     http.StatusOK,
+	} {
+		if rec := get(path); rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	rec = get("/services/Web/Google")
+	if !strings.Contains(rec.Body.String(), "&lt;b&gt;output&lt;/b&gt;") || strings.Contains(rec.Body.String(), "<b>output</b>") {
+		t.Errorf("page should contain the escaped output")
+	}
+	if !strings.Contains(string(opt.htmlBlob), `href="/services/Web/Google"`) {
+		t.Errorf("index should link to the service page")
+	}
+
+	// 出力を隠す
+	opt.rwlock.Lock()
+	svc.HideOutput = true
+	opt.rwlock.Unlock()
+	rec = get("/_json/services/Web/Google")
+	if strings.Contains(rec.Body.String(), "output</b>") || !strings.Contains(rec.Body.String(), `"output_hidden":true`) {
+		t.Errorf("output should be hidden: %s", rec.Body.String())
+	}
+	if rec := get("/services/Web/Google"); strings.Contains(rec.Body.String(), "output&lt;") {
+		t.Errorf("page should not contain the output")
+	}
+}
+
+func TestServiceDetailPath(t *testing.T) {
+	conf, err := loadToml(writeTempToml(t, `
+[[category]]
+name = "グローバル"
+  [[category.service]]
+  name = "API / v2"
+  command = ["true"]
+  [[category.service]]
+  name = "100% up"
+  command = ["true"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// %2F を含むパスと含まないパスの両方で名前を復元できる
+	for _, service := range conf.Categories[0].Services {
+		path := service.DetailPath()
+		rec := httptest.NewRecorder()
+		opt.buildHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_json"+path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"`+service.Name+`"`) {
+			t.Errorf("GET %s = %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+}
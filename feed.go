@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	// feedDays is the number of the days of the logs to find the status transitions
+	feedDays = 7
+	// feedMaxEntries is the maximum number of the entries in a feed
+	feedMaxEntries = 100
+)
+
+// feedEntry is an entry of the feeds. link is the path on this server
+type feedEntry struct {
+	id      string
+	title   string
+	link    string
+	time    time.Time
+	content string
+}
+
+// feed is the entries for the feeds built for a rendering of the page
+type feed struct {
+	title   string
+	updated time.Time
+	entries []*feedEntry
+}
+
+// feedCache keeps the feed until the page is rendered again
+type feedCache struct {
+	mu      sync.Mutex
+	current *feed
+}
+
+// feedID returns a stable id of the entry. the same key always gives the same id
+func feedID(key ...string) string {
+	h := sha1.Sum([]byte(strings.Join(key, "\x00")))
+	// RFC 4122 の version 5 の形にする
+	h[6] = h[6]&0x0f | 0x50
+	h[8] = h[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// feedServiceKey identifies the service in the ids. the id of the service is used if given, so that renaming keeps the ids
+func feedServiceKey(service *Service) string {
+	if service.ID != "" {
+		return service.ID
+	}
+	return serviceKey(service)
+}
+
+// feedService is the service with its maintenance windows taken under the read lock,
+// so that the transitions are found without the lock
+type feedService struct {
+	*Service
+	windows []*Maintenance
+}
+
+// serviceChanges returns the results of the service where the status may change in time order.
+// days are in the order from the oldest. days without the raw logs are skipped
+func serviceChanges(service *Service, days []*daySummary) []logChange {
+	changes := []logChange{}
+	for _, d := range days {
+		if d == nil {
+			continue
+		}
+		for _, e := range d.serviceEntries(service) {
+			if len(e.changes) == 0 {
+				continue
+			}
+			changes = append(changes, e.changes...)
+			// 終了コードが変わらなくてもメンテナンス期間でステータスが変わるので、失敗はすべて見る
+			for _, f := range e.failures {
+				changes = append(changes, logChange{logSample: f})
+			}
+		}
+	}
+	// 同じ結果は出力を持つほうを残す
+	slices.SortStableFunc(changes, func(a, b logChange) int {
+		return a.time.Compare(b.time)
+	})
+	return slices.CompactFunc(changes, func(a, b logChange) bool {
+		return a.time.Equal(b.time) && a.code == b.code
+	})
+}
+
+// transitionEntries finds the changes of the status of each service in the summaries of the days
+func transitionEntries(services []*feedService, days []*daySummary) []*feedEntry {
+	entries := []*feedEntry{}
+	for _, service := range services {
+		var last *statusText
+		for _, c := range serviceChanges(service.Service, days) {
+			status := service.statusIn(c.code, c.time, service.windows)
+			if last == nil || status == last {
+				last = status
+				continue
+			}
+			t := &statusTransition{
+				Time:         c.time,
+				CategoryName: service.categoryName,
+				Name:         service.Name,
+				From:         last,
+				To:           status,
+			}
+			// 非公開の出力はフィードにも載せない
+			if !service.HideOutput {
+				t.Message = c.message
+			}
+			entries = append(entries, &feedEntry{
+				id:      feedID("transition", feedServiceKey(service.Service), c.time.UTC().Format(time.RFC3339Nano)),
+				title:   t.Subject(),
+				link:    service.DetailPath(),
+				time:    c.time,
+				content: "<pre>" + html.EscapeString(t.Text()) + "</pre>",
+			})
+			last = status
+		}
+	}
+	return entries
+}
+
+// incidentEntries returns an entry for each update of the incidents
+func incidentEntries(incidents []*Incident) []*feedEntry {
+	entries := []*feedEntry{}
+	for _, incident := range incidents {
+		for i, update := range incident.Updates {
+			content := ""
+			if update.Body != nil {
+				content = string(update.Body.HTML())
+			}
+			if !incident.Affected.IsEmpty() {
+				content += "<p>Affected: " + html.EscapeString(incident.Affected.String()) + "</p>"
+			}
+			entries = append(entries, &feedEntry{
+				id:      feedID("incident", fmt.Sprint(incident.ID), fmt.Sprint(i)),
+				title:   fmt.Sprintf("[%s] %s", update.StateText(), incident.Title),
+				link:    "/",
+				time:    update.Time,
+				content: content,
+			})
+		}
+	}
+	return entries
+}
+
+// loadFeed returns the feed for the last rendering of the page
+func (o *Opt) loadFeed() *feed {
+	o.feedCache.mu.Lock()
+	defer o.feedCache.mu.Unlock()
+
+	o.rwlock.RLock()
+	f := &feed{
+		title:   o.config.Title,
+		updated: o.config.LastUpdatedAt,
+	}
+	if c := o.feedCache.current; c != nil && c.updated.Equal(f.updated) {
+		o.rwlock.RUnlock()
+		return c
+	}
+	services := []*feedService{}
+	for _, category := range o.config.Categories {
+		for _, service := range category.Services {
+			services = append(services, &feedService{Service: service, windows: service.maintenances})
+		}
+	}
+	incidents := o.config.Incidents
+	conf := o.config
+	o.rwlock.RUnlock()
+
+	// 描画と同じインデックスから読み、ログファイルは読み直さない
+	o.index.peek(o.logStore(), time.Now(), feedDays, func(days []*daySummary) {
+		for _, d := range days {
+			if d != nil {
+				d.mapServices(conf)
+			}
+		}
+		days = slices.Clone(days)
+		slices.Reverse(days)
+		f.entries = transitionEntries(services, days)
+	})
+	f.entries = append(f.entries, incidentEntries(incidents)...)
+	slices.SortStableFunc(f.entries, func(a, b *feedEntry) int {
+		return b.time.Compare(a.time)
+	})
+	f.entries = f.entries[:min(len(f.entries), feedMaxEntries)]
+	o.feedCache.current = f
+	return f
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Author  atomAuthor   `xml:"author"`
+	Links   []atomLink   `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// baseURL returns the url of this server for the links in the feeds
+func baseURL(c *echo.Context) string {
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+func writeXML(c *echo.Context, contentType string, v any) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, contentType, buf.Bytes())
+}
+
+func (o *Opt) handleAtom(c *echo.Context) error {
+	f := o.loadFeed()
+	base := baseURL(c)
+	atom := &atomFeed{
+		Title:   f.title,
+		ID:      feedID("feed"),
+		Updated: f.updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: f.title},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + "/feed.atom"},
+			{Rel: "alternate", Type: "text/html", Href: base + "/"},
+		},
+		Entries: []*atomEntry{},
+	}
+	for _, e := range f.entries {
+		atom.Entries = append(atom.Entries, &atomEntry{
+			Title:   e.title,
+			ID:      e.id,
+			Updated: e.time.UTC().Format(time.RFC3339),
+			Link:    atomLink{Rel: "alternate", Href: base + e.link},
+			Content: atomContent{Type: "html", Body: e.content},
+		})
+	}
+	return writeXML(c, "application/atom+xml; charset=utf-8", atom)
+}
+
+func (o *Opt) handleRSS(c *echo.Context) error {
+	f := o.loadFeed()
+	base := baseURL(c)
+	rss := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.title,
+			Link:          base + "/",
+			Description:   f.title,
+			LastBuildDate: f.updated.UTC().Format(time.RFC1123Z),
+			Items:         []*rssItem{},
+		},
+	}
+	for _, e := range f.entries {
+		rss.Channel.Items = append(rss.Channel.Items, &rssItem{
+			Title:       e.title,
+			Link:        base + e.link,
+			GUID:        rssGUID{ID: e.id},
+			PubDate:     e.time.UTC().Format(time.RFC1123Z),
+			Description: e.content,
+		})
+	}
+	return writeXML(c, "application/rss+xml; charset=utf-8", rss)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeeds(t *testing.T) {
+	opt := newTestOpt(t)
+	if err := opt.createServiceLog(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := loadIncidentStore(opt.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt.incidents = store
+	now := time.Now()
+	for i, status := range []int{0, 0, 2, 2, 0} {
+		log := &ServiceLog{Time: now.Add(time.Duration(i-5) * time.Hour), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: status, Message: "timeout"}
+		if err := opt.appendServiceLog(log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.create(&Incident{Title: "API is slow", State: IncidentInvestigating, Body: MustMarkdown("**looking**")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e := opt.buildHandler()
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://status.example.com"+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/feed.atom", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("GET /feed.atom = %d %v", rec.Code, rec.Header())
+	}
+	var atom atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &atom); err != nil {
+		t.Fatalf("invalid atom: %v", err)
+	}
+	titles := []string{}
+	for _, entry := range atom.Entries {
+		titles = append(titles, entry.Title)
+	}
+	want := []string{"[Investigating] API is slow", "[Web] Google is Operational", "[Web] Google is Outage"}
+	if strings.Join(titles, ",") != strings.Join(want, ",") {
+		t.Errorf("entries = %v, want %v", titles, want)
+	}
+	// フィードのIDはホスト名によらない
+	if atom.ID != feedID("feed") {
+		t.Errorf("feed id = %q", atom.ID)
+	}
+	if link := atom.Entries[1].Link.Href; link != "http://status.example.com/services/Web/Google" {
+		t.Errorf("link = %q", link)
+	}
+	if !strings.Contains(atom.Entries[0].Content.Body, "<strong>looking</strong>") || !strings.Contains(atom.Entries[2].Content.Body, "Operational -&gt; Outage") {
+		t.Errorf("contents = %q, %q", atom.Entries[0].Content.Body, atom.Entries[2].Content.Body)
+	}
+
+	// 描画し直してもIDは変わらない
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var rss rssFeed
+	rec = get("/feed.rss", nil)
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rss); err != nil {
+		t.Fatalf("invalid rss: %v", err)
+	}
+	if len(rss.Channel.Items) != len(atom.Entries) {
+		t.Fatalf("items = %d, want %d", len(rss.Channel.Items), len(atom.Entries))
+	}
+	for i, item := range rss.Channel.Items {
+		if item.GUID.ID != atom.Entries[i].ID || item.GUID.IsPermaLink || !strings.HasPrefix(item.GUID.ID, "urn:uuid:") {
+			t.Errorf("guid = %v, want %q", item.GUID, atom.Entries[i].ID)
+		}
+	}
+
+	lastModified := rec.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatalf("Last-Modified should be set")
+	}
+	for _, path := range []string{"/feed.atom", "/feed.rss"} {
+		if rec := get(path, http.Header{"If-Modified-Since": {lastModified}}); rec.Code != http.StatusNotModified {
+			t.Errorf("GET %s with If-Modified-Since = %d, want 304", path, rec.Code)
+		}
+	}
+}
+
+func TestTransitionEntries(t *testing.T) {
+	opt := newTestOpt(t)
+	service := opt.config.Categories[0].Services[0]
+	base := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	at := func(h int) time.Time { return base.Add(time.Duration(h) * time.Hour) }
+	log := func(h, status int, message string) *ServiceLog {
+		return &ServiceLog{Time: at(h), Name: "Google", CategoryName: "Web", Status: status, Message: message}
+	}
+	// 前日は描画で compact され、すべての結果のサンプルは持たない
+	yesterday := summarizeLogs([]*ServiceLog{log(-24, 0, ""), log(-23, 2, "down"), log(-22, 2, "down"), log(-21, 0, "ok")}, at(-21))
+	yesterday.compact(1)
+	today := summarizeLogs([]*ServiceLog{log(-4, 0, ""), log(-3, 1, "slow"), log(-2, 1, "slow"), log(-1, 1, "slow"), log(0, 0, "ok")}, at(0))
+	// メンテナンス中の失敗はMaintenance
+	windows := []*Maintenance{{Start: at(-1), End: at(0)}}
+	services := []*feedService{{Service: service, windows: windows}}
+
+	entries := transitionEntries(services, []*daySummary{yesterday, nil, today})
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.time.Format("15")+" "+e.title)
+	}
+	want := []string{
+		"13 [Web] Google is Outage",
+		"15 [Web] Google is Operational",
+		"09 [Web] Google is Outage",
+		"11 [Web] Google is Maintenance",
+		"12 [Web] Google is Operational",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if !strings.Contains(entries[0].content, "down") {
+		t.Errorf("content should contain the output: %q", entries[0].content)
+	}
+
+	// 非公開の出力はフィードにも載せない
+	service.HideOutput = true
+	for _, e := range transitionEntries(services, []*daySummary{yesterday, today}) {
+		if strings.Contains(e.content, "down") || strings.Contains(e.content, "slow") {
+			t.Errorf("output should be hidden: %q", e.content)
+		}
+	}
+
+	// 生のログのない日は読まない
+	summary := &daySummary{entries: map[string]*logEntry{}}
+	for k, e := range yesterday.entries {
+		summary.entries[k] = &logEntry{ServiceID: e.ServiceID, CategoryName: e.CategoryName, Name: e.Name, codes: e.codes, failures: e.failures}
+	}
+	if entries := transitionEntries(services, []*daySummary{summary}); len(entries) != 0 {
+		t.Errorf("entries of the summary = %d, want 0", len(entries))
+	}
+
+	if id := feedID("transition", "a"); id != feedID("transition", "a") || id == feedID("transition", "b") {
+		t.Errorf("feedID should be stable and unique")
+	}
+}
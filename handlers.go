@@ -113,6 +113,12 @@ func (o *Opt) handleJSON(c *echo.Context) error {
 func (o *Opt) handleIndex(c *echo.Context) error {
 	o.rwlock.RLock()
 	defer o.rwlock.RUnlock()
+	if o.config.AcceptLanguage {
+		c.Response().Header().Add("Vary", "Accept-Language")
+		if blob, ok := o.htmlBlobs[o.config.negotiateLanguage(c.Request())]; ok {
+			return c.HTMLBlob(http.StatusOK, blob)
+		}
+	}
 	return c.HTMLBlob(http.StatusOK, o.htmlBlob)
 }
 
@@ -122,7 +128,7 @@ func (o *Opt) buildHandler() *echo.Echo {
 
 	skipper := func(c *echo.Context) bool {
 		switch c.Request().URL.Path {
-		case "/favicon.ico", "/live":
+		case "/favicon.ico", "/live", "/ready":
 			return true
 		default:
 			return false
@@ -131,6 +137,9 @@ func (o *Opt) buildHandler() *echo.Echo {
 
 	e.Use(RequestLogger(skipper))
 	e.Use(middleware.Recover())
+	if o.metrics != nil {
+		e.Use(o.metrics.middleware)
+	}
 
 	// Route level middleware
 	conditionalGET := func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -148,6 +157,29 @@ func (o *Opt) buildHandler() *echo.Echo {
 	// Routes
 	e.GET("/", o.handleIndex, conditionalGET)
 	e.GET("/_json", o.handleJSON, conditionalGET)
+	e.GET("/feed.atom", o.handleAtom, conditionalGET)
+	e.GET("/feed.rss", o.handleRSS, conditionalGET)
+	e.GET("/services/:category/:name", o.handleServicePage)
+	e.GET("/_json/services/:category/:name", o.handleServiceJSON)
+	e.GET("/assets/:name", o.handleAsset)
+	e.GET("/static/*", o.handleStatic)
+	e.GET("/live", o.handleLive)
+	e.GET("/ready", o.handleReady)
+	if o.metrics != nil {
+		e.GET("/metrics", o.metrics.handler())
+	}
+
+	// admin API is enabled only when the token is given
+	if o.AdminToken != "" && o.incidents != nil && o.maintenances != nil {
+		admin := e.Group("/_admin", o.adminAuth)
+		admin.GET("/incidents", o.handleListIncidents)
+		admin.POST("/incidents", o.handleCreateIncident)
+		admin.POST("/incidents/:id/updates", o.handleUpdateIncident)
+		admin.POST("/incidents/:id/resolve", o.handleResolveIncident)
+		admin.GET("/maintenances", o.handleListMaintenances)
+		admin.POST("/maintenances", o.handleCreateMaintenance)
+		admin.DELETE("/maintenances/:id", o.handleDeleteMaintenance)
+	}
 	return e
 }
 
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+// workerHealth records when the worker started, when each service was scheduled and when it was checked last.
+// the zero value is ready to use
+type workerHealth struct {
+	mu          sync.Mutex
+	startedAt   time.Time
+	scheduledAt map[string]time.Time
+	lastChecked map[string]time.Time
+}
+
+func serviceKey(service *Service) string {
+	return service.categoryName + "\x00" + service.Name
+}
+
+func (h *workerHealth) start(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startedAt = t
+}
+
+// scheduled records when the scheduler of the service started. used until the service is checked first
+func (h *workerHealth) scheduled(service *Service, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.scheduledAt == nil {
+		h.scheduledAt = map[string]time.Time{}
+	}
+	h.scheduledAt[serviceKey(service)] = t
+}
+
+func (h *workerHealth) checked(service *Service, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastChecked == nil {
+		h.lastChecked = map[string]time.Time{}
+	}
+	h.lastChecked[serviceKey(service)] = t
+}
+
+func (h *workerHealth) lastCheckedAt(service *Service) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.lastChecked[serviceKey(service)]
+	return t, ok
+}
+
+// stalled returns the first service not checked within 3 intervals (plus worker_timeout for the check itself)
+func (h *workerHealth) stalled(conf *Config, now time.Time) (*Service, time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, category := range conf.Categories {
+		for _, service := range category.Services {
+			last, ok := h.lastChecked[serviceKey(service)]
+			if !ok {
+				// 再読み込みで追加されたサービスはスケジュールした時から数える
+				last = h.scheduledAt[serviceKey(service)]
+			}
+			if last.Before(h.startedAt) {
+				last = h.startedAt
+			}
+			limit := 3*service.WorkerInterval.Duration + service.WorkerTimeout.Duration
+			if now.Sub(last) > limit {
+				return service, last, true
+			}
+		}
+	}
+	return nil, time.Time{}, false
+}
+
+type healthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type healthResponse struct {
+	Status string         `json:"status"`
+	Checks []*healthCheck `json:"checks,omitempty"`
+}
+
+func (o *Opt) handleLive(c *echo.Context) error {
+	return c.JSON(http.StatusOK, &healthResponse{Status: "ok"})
+}
+
+// checkDataDir confirms that a file can be created in the data dir
+func (o *Opt) checkDataDir() error {
+	f, err := os.CreateTemp(o.Data, ".ready")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (o *Opt) readyChecks(now time.Time) []*healthCheck {
+	// 遅いボリュームで描画や再読み込みを止めないよう、ファイルの作成はロックの外で行う
+	data := &healthCheck{Name: "data_dir", OK: true}
+	if err := o.checkDataDir(); err != nil {
+		data.OK = false
+		data.Message = err.Error()
+	}
+
+	o.rwlock.RLock()
+	defer o.rwlock.RUnlock()
+
+	checks := []*healthCheck{}
+	config := &healthCheck{Name: "config", OK: o.config != nil}
+	if !config.OK {
+		config.Message = "configuration is not loaded"
+	}
+	checks = append(checks, config)
+
+	checks = append(checks, data)
+
+	render := &healthCheck{Name: "render", OK: o.htmlBlob != nil}
+	if !render.OK {
+		render.Message = "status page has not been rendered yet"
+	}
+	checks = append(checks, render)
+
+	worker := &healthCheck{Name: "worker", OK: true}
+	o.health.mu.Lock()
+	started := !o.health.startedAt.IsZero()
+	o.health.mu.Unlock()
+	switch {
+	case !started:
+		worker.OK = false
+		worker.Message = "worker has not started yet"
+	case o.config != nil:
+		if service, last, ok := o.health.stalled(o.config, now); ok {
+			worker.OK = false
+			worker.Message = "service [" + service.categoryName + "] " + service.Name + " has not been checked since " + last.Format(time.RFC3339)
+		}
+	}
+	checks = append(checks, worker)
+	return checks
+}
+
+func (o *Opt) handleReady(c *echo.Context) error {
+	checks := o.readyChecks(time.Now())
+	res := &healthResponse{Status: "ok", Checks: checks}
+	for _, check := range checks {
+		if !check.OK {
+			res.Status = "ng"
+			return c.JSON(http.StatusServiceUnavailable, res)
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
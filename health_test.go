@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gammazero/workerpool"
+)
+
+func readyRequest(t *testing.T, opt *Opt) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	opt.buildHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	res := map[string]any{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rec.Code, res
+}
+
+func failedCheck(res map[string]any) string {
+	checks, _ := res["checks"].([]any)
+	for _, c := range checks {
+		check := c.(map[string]any)
+		if check["ok"] != true {
+			return check["name"].(string)
+		}
+	}
+	return ""
+}
+
+func TestHealth(t *testing.T) {
+	tomlContent := `
+worker_interval = "1m"
+worker_timeout = "10s"
+
+[[category]]
+name = "Web"
+
+  [[category.service]]
+  name = "OK"
+  command = ["true"]
+`
+	conf, err := loadToml(writeTempToml(t, tomlContent))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+
+	rec := httptest.NewRecorder()
+	opt.buildHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/live status = %d, want 200", rec.Code)
+	}
+
+	code, res := readyRequest(t, opt)
+	if code != http.StatusServiceUnavailable || failedCheck(res) != "render" {
+		t.Errorf("before render: status = %d, failed = %q", code, failedCheck(res))
+	}
+
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	code, res = readyRequest(t, opt)
+	if code != http.StatusServiceUnavailable || failedCheck(res) != "worker" {
+		t.Errorf("before worker start: status = %d, failed = %q", code, failedCheck(res))
+	}
+
+	opt.health.start(time.Now())
+	code, res = readyRequest(t, opt)
+	if code != http.StatusOK || res["status"] != "ok" {
+		t.Errorf("ready: status = %d, res = %v", code, res)
+	}
+
+	// 3回分のインターバルとタイムアウトを過ぎてもチェックが終わらなければ停止とみなす
+	now := time.Now()
+	opt.health.start(now.Add(-4 * time.Minute))
+	if _, _, ok := opt.health.stalled(conf, now); !ok {
+		t.Errorf("worker should be stalled")
+	}
+	opt.health.checked(conf.Categories[0].Services[0], now.Add(-1*time.Minute))
+	if _, _, ok := opt.health.stalled(conf, now); ok {
+		t.Errorf("worker should not be stalled")
+	}
+
+	opt.Data = filepath.Join(t.TempDir(), "missing")
+	code, res = readyRequest(t, opt)
+	if code != http.StatusServiceUnavailable || failedCheck(res) != "data_dir" {
+		t.Errorf("missing data dir: status = %d, failed = %q", code, failedCheck(res))
+	}
+}
+
+func TestHealth_ServiceAddedByReload(t *testing.T) {
+	conf, err := loadToml(writeTempToml(t, `
+worker_interval = "1m"
+worker_timeout = "10s"
+
+[[category]]
+name = "Web"
+
+  [[category.service]]
+  name = "OK"
+  command = ["true"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+	now := time.Now()
+	// 長く動いているプロセスで、既存のサービスは定期的にチェックされている
+	opt.health.start(now.Add(-time.Hour))
+	opt.health.checked(conf.Categories[0].Services[0], now.Add(-30*time.Second))
+
+	// 再読み込みで追加されたサービスはまだチェックされていない
+	added := &Service{Name: "Added", Command: []string{"true"}, categoryName: "Web", WorkerInterval: conf.WorkerInterval, WorkerTimeout: conf.WorkerTimeout}
+	conf.Categories[0].Services = append(conf.Categories[0].Services, added)
+	if service, _, ok := opt.health.stalled(conf, now); !ok || service != added {
+		t.Fatalf("service not scheduled should be counted from the start of the worker")
+	}
+
+	// スケジュールし直した時から数える
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := workerpool.New(1)
+	defer pool.StopWait()
+	opt.startSchedulers(ctx, ctx, pool, map[string]*atomic.Bool{}, make(chan struct{}, 1)).Wait()
+	if service, _, ok := opt.health.stalled(conf, time.Now()); ok {
+		t.Errorf("%s should not be stalled right after it is scheduled", service.Name)
+	}
+	if _, _, ok := opt.health.stalled(conf, time.Now().Add(4*time.Minute)); !ok {
+		t.Errorf("worker should be stalled if the added service is not checked")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// catalog is the translations of the messages in the templates. the messages are keyed by the English text
+type catalog struct {
+	lang string
+	// layout of the days in the history
+	dayFormat string
+	messages  map[string]string
+}
+
+var catalogs = map[string]*catalog{
+	"en": {
+		lang:      "en",
+		dayFormat: "01/02",
+		messages:  map[string]string{},
+	},
+	"ja": {
+		lang:      "ja",
+		dayFormat: "1/2",
+		messages: map[string]string{
+			// statuses
+			"Operational": "正常",
+			"Degraded":    "一部低下",
+			"Outage":      "障害",
+			"Maintenance": "メンテナンス",
+			"NoData":      "データなし",
+			// incidents
+			"Investigating": "調査中",
+			"Identified":    "原因特定",
+			"Monitoring":    "経過観察",
+			"Resolved":      "解決済み",
+			"Affected":      "影響範囲",
+			// maintenances
+			"Maintenance in progress": "メンテナンス中",
+			"Scheduled maintenance":   "メンテナンス予定",
+			// index
+			"uptime (30d)":    "稼働率 (30日)",
+			"%d days":         "%d日間",
+			"7d":              "7日",
+			"30d":             "30日",
+			"90d":             "90日",
+			"Last updated at": "最終更新",
+			"JSON version":    "JSON版",
+			// service
+			"Time":                    "時刻",
+			"Status":                  "ステータス",
+			"Exit code":               "終了コード",
+			"Duration":                "所要時間",
+			"Output":                  "出力",
+			"Show":                    "表示",
+			"No checks in this range": "この期間のチェック結果はありません",
+			"Newer":                   "新しい結果",
+			"Older":                   "古い結果",
+			"%d checks / page %d":     "%d件 / %dページ目",
+		},
+	},
+}
+
+// defaultCatalog is used for the languages without translations
+var defaultCatalog = catalogs["en"]
+
+func catalogFor(lang string) *catalog {
+	if c, ok := catalogs[lang]; ok {
+		return c
+	}
+	return defaultCatalog
+}
+
+// translate returns the message in the language. messages without the translation are returned as is
+func (c *catalog) translate(msg string, args ...any) string {
+	if t, ok := c.messages[msg]; ok {
+		msg = t
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Label returns the status in the language for the page. JSON keeps the English status
+func (s *statusText) Label(lang string) string {
+	return catalogFor(lang).translate(s.string)
+}
+
+// locale is a variant of the page. the default one is rendered with lang and the messages of the configuration
+type locale struct {
+	// key of the rendered page. "" for the default
+	key     string
+	lang    string
+	catalog *catalog
+}
+
+// locales returns the variants of the page to render. all languages with the translations if accept_language
+func (c *Config) locales() []*locale {
+	locales := []*locale{{key: "", lang: c.Lang, catalog: catalogFor(c.messageLang)}}
+	if c.AcceptLanguage {
+		for _, lang := range slices.Sorted(maps.Keys(catalogs)) {
+			locales = append(locales, &locale{key: lang, lang: lang, catalog: catalogs[lang]})
+		}
+	}
+	return locales
+}
+
+// funcs returns the template functions depending on the language
+func (l *locale) funcs() texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"lang": func() string {
+			return l.lang
+		},
+		"t": l.catalog.translate,
+		"status": func(s *statusText) string {
+			return s.Label(l.catalog.lang)
+		},
+		"days": func(c *Config) []string {
+			if len(c.dates) == 0 {
+				return c.Days
+			}
+			// 先頭は最新の状態の期間
+			days := []string{c.Days[0]}
+			for _, d := range c.dates {
+				days = append(days, d.Format(l.catalog.dayFormat))
+			}
+			return days
+		},
+	}
+}
+
+// localizeTemplates clones the templates for each locale
+func localizeTemplates(t *texttemplate.Template, locales []*locale) (map[string]*texttemplate.Template, error) {
+	templates := map[string]*texttemplate.Template{}
+	for _, l := range locales {
+		c, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		templates[l.key] = c.Funcs(l.funcs())
+	}
+	return templates, nil
+}
+
+// negotiateLanguage returns the key of the page for the Accept-Language header. "" if no language is acceptable
+func (c *Config) negotiateLanguage(r *http.Request) string {
+	if !c.AcceptLanguage {
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		// ja-JP のような地域付きの指定は言語だけで一致させる
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := catalogs[lang]; ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
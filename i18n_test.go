@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newI18nTestOpt(t *testing.T, toml string) *Opt {
+	t.Helper()
+	conf, err := loadToml(writeTempToml(t, toml+`
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return opt
+}
+
+func TestRenderStatusPage_Lang(t *testing.T) {
+	// lang を指定しなければこれまで通り英語
+	opt := newI18nTestOpt(t, ``)
+	if html := string(opt.htmlBlob); !strings.Contains(html, `<html lang="ja">`) || !strings.Contains(html, "Last updated at") || !strings.Contains(html, "<span>NoData</span>") {
+		t.Errorf("page should be in English without lang")
+	}
+
+	opt = newI18nTestOpt(t, `lang = "ja"`)
+	html := string(opt.htmlBlob)
+	for _, want := range []string{`<html lang="ja">`, "最終更新", "稼働率 (30日)", "<span>データなし</span>", "JSON版"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page should contain %q", want)
+		}
+	}
+	if strings.Contains(html, "Last updated at") {
+		t.Errorf("page should not contain English messages")
+	}
+	// JSONのステータスは英語のまま
+	rec := httptest.NewRecorder()
+	opt.buildHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_json", nil))
+	if !strings.Contains(rec.Body.String(), `"latest_status":"NoData"`) {
+		t.Errorf("json should keep the English status: %s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	opt.buildHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/services/Web/API", nil))
+	if !strings.Contains(rec.Body.String(), "終了コード") || !strings.Contains(rec.Body.String(), "この期間のチェック結果はありません") {
+		t.Errorf("service page should be in Japanese")
+	}
+
+	// 翻訳のない言語は英語で表示する
+	opt = newI18nTestOpt(t, `lang = "fr"`)
+	if html := string(opt.htmlBlob); !strings.Contains(html, `<html lang="fr">`) || !strings.Contains(html, "Last updated at") {
+		t.Errorf("page should be in English for fr")
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	opt := newI18nTestOpt(t, "lang = \"ja\"\naccept_language = true")
+	e := opt.buildHandler()
+	for header, want := range map[string]string{
+		"":                          "最終更新",
+		"en-US,en;q=0.9":            "Last updated at",
+		"fr-FR, en;q=0.5, ja;q=0.8": "最終更新",
+		"fr":                        "最終更新",
+		"ja;q=0.1, EN":              "Last updated at",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("Accept-Language", header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Accept-Language %q: page should contain %q", header, want)
+		}
+		if rec.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("Vary = %q, want Accept-Language", rec.Header().Get("Vary"))
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "en")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `<html lang="en">`) {
+		t.Errorf("lang attribute should be en")
+	}
+}
+
+func TestLocaleFuncs(t *testing.T) {
+	conf := &Config{
+		Days:  []string{"1h", "01/05", "01/04"},
+		dates: []time.Time{time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local), time.Date(2026, 1, 4, 0, 0, 0, 0, time.Local)},
+	}
+	ja := (&locale{lang: "ja", catalog: catalogs["ja"]}).funcs()
+	if days := ja["days"].(func(*Config) []string)(conf); strings.Join(days, ",") != "1h,1/5,1/4" {
+		t.Errorf("days = %v", days)
+	}
+	if got := ja["t"].(func(string, ...any) string)("%d days", 30); got != "30日間" {
+		t.Errorf("t = %q", got)
+	}
+	if got := ja["t"].(func(string, ...any) string)("Custom message"); got != "Custom message" {
+		t.Errorf("message without the translation should be returned as is: %q", got)
+	}
+	if Outage.Label("ja") != "障害" || Outage.Label("en") != "Outage" || Outage.Label("de") != "Outage" {
+		t.Errorf("Label = %q, %q, %q", Outage.Label("ja"), Outage.Label("en"), Outage.Label("de"))
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+var incidentStates = []string{IncidentInvestigating, IncidentIdentified, IncidentMonitoring, IncidentResolved}
+
+// Affected is a set of categories and services referred by name
+type Affected struct {
+	Categories []string `toml:"categories" json:"categories"`
+	Services   []string `toml:"services" json:"services"`
+}
+
+func (a *Affected) includes(service *Service) bool {
+	return slices.Contains(a.Categories, service.categoryName) || slices.Contains(a.Services, service.Name)
+}
+
+// validate checks that all the names exist in the configuration
+func (a *Affected) validate(conf *Config) error {
+	for _, name := range a.Categories {
+		found := slices.ContainsFunc(conf.Categories, func(c *Category) bool { return c.Name == name })
+		if !found {
+			return errors.Errorf("unknown category %q", name)
+		}
+	}
+	for _, name := range a.Services {
+		found := false
+		for _, category := range conf.Categories {
+			if slices.ContainsFunc(category.Services, func(s *Service) bool { return s.Name == name }) {
+				found = true
+			}
+		}
+		if !found {
+			return errors.Errorf("unknown service %q", name)
+		}
+	}
+	return nil
+}
+
+func (a *Affected) IsEmpty() bool {
+	return len(a.Categories) == 0 && len(a.Services) == 0
+}
+
+func (a *Affected) String() string {
+	return strings.Join(append(slices.Clone(a.Categories), a.Services...), ", ")
+}
+
+type IncidentUpdate struct {
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+	Body  *markdown `json:"body"`
+}
+
+type Incident struct {
+	ID    int       `json:"id"`
+	Title string    `json:"title"`
+	Body  *markdown `json:"body"`
+	State string    `json:"state"`
+	Affected
+	Updates    []*IncidentUpdate `json:"updates"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	ResolvedAt *time.Time        `json:"resolved_at"`
+}
+
+func (i *Incident) IsResolved() bool {
+	return i.State == IncidentResolved
+}
+
+// StateText returns the state for display
+func (i *Incident) StateText() string {
+	return stateText(i.State)
+}
+
+// StateText returns the state of the update for display
+func (u *IncidentUpdate) StateText() string {
+	return stateText(u.State)
+}
+
+func stateText(state string) string {
+	if state == "" {
+		return ""
+	}
+	return strings.ToUpper(state[:1]) + state[1:]
+}
+
+// LatestUpdates returns the updates in reverse chronological order
+func (i *Incident) LatestUpdates() []*IncidentUpdate {
+	updates := slices.Clone(i.Updates)
+	slices.Reverse(updates)
+	return updates
+}
+
+func (i *Incident) clone() *Incident {
+	c := *i
+	c.Categories = slices.Clone(i.Categories)
+	c.Services = slices.Clone(i.Services)
+	c.Updates = slices.Clone(i.Updates)
+	return &c
+}
+
+// incidentStore keeps incidents in memory and persists them to incidents.json in the data dir
+type incidentStore struct {
+	path      string
+	mu        sync.RWMutex
+	incidents []*Incident
+}
+
+func loadIncidentStore(dir string) (*incidentStore, error) {
+	s := &incidentStore{
+		path:      filepath.Join(dir, "incidents.json"),
+		incidents: []*Incident{},
+	}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read incidents")
+	}
+	if err := json.Unmarshal(b, &s.incidents); err != nil {
+		return nil, errors.Wrap(err, "failed to decode incidents")
+	}
+	return s, nil
+}
+
+// writeJSONFile replaces the file with v encoded as JSON atomically
+func writeJSONFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// save writes all incidents. must be called with the lock held
+func (s *incidentStore) save() error {
+	return writeJSONFile(s.path, s.incidents)
+}
+
+// list returns copies of unresolved incidents and incidents resolved after since, newest first
+func (s *incidentStore) list(since time.Time) []*Incident {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	incidents := []*Incident{}
+	for i := len(s.incidents) - 1; i >= 0; i-- {
+		incident := s.incidents[i]
+		if incident.IsResolved() && incident.ResolvedAt != nil && incident.ResolvedAt.Before(since) {
+			continue
+		}
+		incidents = append(incidents, incident.clone())
+	}
+	return incidents
+}
+
+func (s *incidentStore) create(incident *Incident) (*Incident, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	incident.ID = 1
+	if len(s.incidents) > 0 {
+		incident.ID = s.incidents[len(s.incidents)-1].ID + 1
+	}
+	now := time.Now()
+	incident.CreatedAt = now
+	incident.UpdatedAt = now
+	incident.Updates = []*IncidentUpdate{{Time: now, State: incident.State, Body: incident.Body}}
+	if incident.IsResolved() {
+		incident.ResolvedAt = &now
+	}
+	s.incidents = append(s.incidents, incident)
+	if err := s.save(); err != nil {
+		s.incidents = s.incidents[:len(s.incidents)-1]
+		return nil, err
+	}
+	return incident.clone(), nil
+}
+
+// update appends an update to the incident and changes its state
+func (s *incidentStore) update(id int, state string, body *markdown) (*Incident, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.incidents, func(i *Incident) bool { return i.ID == id })
+	if idx < 0 {
+		return nil, os.ErrNotExist
+	}
+	prev := s.incidents[idx]
+	incident := prev.clone()
+	now := time.Now()
+	if state != "" {
+		incident.State = state
+	}
+	incident.UpdatedAt = now
+	incident.ResolvedAt = nil
+	if incident.IsResolved() {
+		incident.ResolvedAt = &now
+	}
+	incident.Updates = append(incident.Updates, &IncidentUpdate{Time: now, State: incident.State, Body: body})
+	s.incidents[idx] = incident
+	if err := s.save(); err != nil {
+		s.incidents[idx] = prev
+		return nil, err
+	}
+	return incident.clone(), nil
+}
+
+type incidentRequest struct {
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	State      string   `json:"state"`
+	Categories []string `json:"categories"`
+	Services   []string `json:"services"`
+}
+
+// adminAuth requires the admin token as a bearer token
+func (o *Opt) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(o.AdminToken)) != 1 {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid admin token")
+		}
+		return next(c)
+	}
+}
+
+func (o *Opt) handleListIncidents(c *echo.Context) error {
+	return c.JSON(http.StatusOK, o.incidents.list(time.Time{}))
+}
+
+func (o *Opt) handleCreateIncident(c *echo.Context) error {
+	req := &incidentRequest{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if req.Title == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "title is required")
+	}
+	if req.State == "" {
+		req.State = IncidentInvestigating
+	}
+	if !slices.Contains(incidentStates, req.State) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown state %q", req.State))
+	}
+	body := &markdown{}
+	if err := body.UnmarshalText([]byte(req.Body)); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to convert body").Wrap(err)
+	}
+	incident := &Incident{
+		Title:    req.Title,
+		Body:     body,
+		State:    req.State,
+		Affected: Affected{Categories: req.Categories, Services: req.Services},
+	}
+	o.rwlock.RLock()
+	err := incident.Affected.validate(o.config)
+	o.rwlock.RUnlock()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	incident, err = o.incidents.create(incident)
+	if err != nil {
+		return err
+	}
+	if err := o.renderStatusPage(c.Request().Context()); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, incident)
+}
+
+func (o *Opt) updateIncident(c *echo.Context, state string) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "incident not found")
+	}
+	req := &incidentRequest{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if state == "" {
+		state = req.State
+	}
+	if state != "" && !slices.Contains(incidentStates, state) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown state %q", state))
+	}
+	body := &markdown{}
+	if err := body.UnmarshalText([]byte(req.Body)); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to convert body").Wrap(err)
+	}
+	incident, err := o.incidents.update(id, state, body)
+	if errors.Is(err, os.ErrNotExist) {
+		return echo.NewHTTPError(http.StatusNotFound, "incident not found")
+	}
+	if err != nil {
+		return err
+	}
+	if err := o.renderStatusPage(c.Request().Context()); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, incident)
+}
+
+func (o *Opt) handleUpdateIncident(c *echo.Context) error {
+	return o.updateIncident(c, "")
+}
+
+func (o *Opt) handleResolveIncident(c *echo.Context) error {
+	return o.updateIncident(c, IncidentResolved)
+}
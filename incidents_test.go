@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncidentStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := loadIncidentStore(dir)
+	if err != nil {
+		t.Fatalf("loadIncidentStore failed: %v", err)
+	}
+	created, err := store.create(&Incident{
+		Title:    "API errors",
+		Body:     MustMarkdown("investigating **elevated** error rates"),
+		State:    IncidentInvestigating,
+		Affected: Affected{Services: []string{"Google"}},
+	})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if created.ID != 1 || len(created.Updates) != 1 {
+		t.Errorf("created = %+v, want id 1 with 1 update", created)
+	}
+	if _, err := store.update(created.ID, IncidentResolved, MustMarkdown("fixed")); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, err := store.update(99, IncidentResolved, MustMarkdown("")); err == nil {
+		t.Errorf("update of unknown incident should fail")
+	}
+
+	// reload from the data dir
+	store, err = loadIncidentStore(dir)
+	if err != nil {
+		t.Fatalf("loadIncidentStore failed: %v", err)
+	}
+	incidents := store.list(time.Now().Add(-time.Hour))
+	if len(incidents) != 1 {
+		t.Fatalf("incidents = %d, want 1", len(incidents))
+	}
+	incident := incidents[0]
+	if !incident.IsResolved() || incident.ResolvedAt == nil {
+		t.Errorf("incident should be resolved: %+v", incident)
+	}
+	if len(incident.Updates) != 2 || incident.LatestUpdates()[0].Body.original != "fixed" {
+		t.Errorf("updates = %+v, want 2 updates with the latest first", incident.Updates)
+	}
+	if !strings.Contains(string(incident.Body.HTML()), "<strong>elevated</strong>") {
+		t.Errorf("body = %q, want markdown rendered", incident.Body.HTML())
+	}
+	if len(store.list(time.Now().Add(time.Hour))) != 0 {
+		t.Errorf("resolved incident should not be listed after since")
+	}
+}
+
+func adminRequest(t *testing.T, h http.Handler, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIncidentAdminAPI(t *testing.T) {
+	opt := newTestOpt(t)
+	opt.AdminToken = "secret"
+	store, err := loadIncidentStore(opt.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt.incidents = store
+	if opt.maintenances, err = loadMaintenanceStore(opt.Data); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e := opt.buildHandler()
+
+	rec := adminRequest(t, e, http.MethodPost, "/_admin/incidents", "wrong", map[string]any{"title": "x"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 for wrong token", rec.Code)
+	}
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/incidents", "secret", map[string]any{"title": "x", "services": []string{"Unknown"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for unknown service", rec.Code)
+	}
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/incidents", "secret", map[string]any{
+		"title":      "Elevated error rates",
+		"body":       "We are investigating.",
+		"categories": []string{"Web"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte("Elevated error rates")) {
+		t.Errorf("htmlBlob does not contain the incident")
+	}
+
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/incidents/1/updates", "secret", map[string]any{
+		"state": IncidentIdentified,
+		"body":  "Found the cause.",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/incidents/1/resolve", "secret", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/incidents/2/resolve", "secret", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for unknown incident", rec.Code)
+	}
+
+	rec = adminRequest(t, e, http.MethodGet, "/_json", "", nil)
+	payload := struct {
+		Incidents []struct {
+			Title   string `json:"title"`
+			State   string `json:"state"`
+			Updates []struct {
+				State string `json:"state"`
+				Body  string `json:"body"`
+			} `json:"updates"`
+		} `json:"incidents"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("json decode failed: %v", err)
+	}
+	if len(payload.Incidents) != 1 {
+		t.Fatalf("incidents = %d, want 1", len(payload.Incidents))
+	}
+	incident := payload.Incidents[0]
+	if incident.State != IncidentResolved || len(incident.Updates) != 3 || incident.Updates[1].Body != "Found the cause." {
+		t.Errorf("incident = %+v", incident)
+	}
+
+	// タイトルはHTMLとして解釈しない
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/incidents", "secret", map[string]any{"title": "latency < 100ms <b>", "state": IncidentResolved})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte("latency &lt; 100ms &lt;b&gt;")) || bytes.Contains(opt.htmlBlob, []byte("<b>")) {
+		t.Errorf("incident title should be escaped")
+	}
+}
+
+func TestIncidentAdminAPI_Disabled(t *testing.T) {
+	opt := newTestOpt(t)
+	e := opt.buildHandler()
+	rec := adminRequest(t, e, http.MethodGet, "/_admin/incidents", "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 without admin token", rec.Code)
+	}
+}
@@ -1,206 +1,323 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	_ "embed"
-	"fmt"
-	"log/slog"
-	"os"
-	"path/filepath"
-	"text/template"
+	"slices"
 	"time"
-
-	"github.com/goccy/go-json"
-	"github.com/pkg/errors"
 )
 
-//go:embed files/index.html
-var indexhtml []byte
-
+// createServiceLog prepares the storage of the logs and checks it is writable
 func (o *Opt) createServiceLog() error {
-	day := time.Now().Format("20060102")
-	path := filepath.Join(o.Data, fmt.Sprintf("log%s.txt", day))
-
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
+	if err := o.logStore().init(); err != nil {
 		return err
 	}
-	defer file.Close()
-	return nil
+	return o.migrateTimezone()
 }
 
 func (o *Opt) appendServiceLog(log *ServiceLog) error {
-	day := log.Time.Format("20060102")
-	path := filepath.Join(o.Data, fmt.Sprintf("log%s.txt", day))
+	return o.index.append(o.logStore(), log)
+}
 
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return err
+func sameCommand(c []string, s []string) bool {
+	if len(c) != len(s) {
+		return false
+	}
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i] != s[i] {
+			return false
+		}
 	}
-	defer file.Close()
-	return json.NewEncoder(file).Encode(log)
+	return true
 }
 
-func (o *Opt) loadServiceLog(_ context.Context, d time.Time) (time.Time, []*ServiceLog, []*ServiceLog, error) {
-	logs := make([]*ServiceLog, 0, 500)
-	latestLogs := make([]*ServiceLog, 0, 500)
+type statusCount struct {
+	operational int
+	degraded    int
+	outage      int
+	maintenance int
+}
+
+func (c *statusCount) add(status *statusText) {
+	c.addN(status, 1)
+}
 
-	day := d.Format("20060102")
-	path := filepath.Join(o.Data, fmt.Sprintf("log%s.txt", day))
-	file, err := os.Open(path)
-	if err != nil {
-		return time.Now(), logs, latestLogs, err
+func (c *statusCount) addN(status *statusText, n int) {
+	switch status {
+	case Operational:
+		c.operational += n
+	case Degraded:
+		c.degraded += n
+	case Outage:
+		c.outage += n
+	case MaintenanceStatus:
+		c.maintenance += n
 	}
-	defer file.Close()
+}
 
-	scanner := bufio.NewScanner(file)
-	lastUpdated := time.Now()
-	// 各行を読み込み
-	for scanner.Scan() {
-		servicelog := &ServiceLog{}
-		// JSON をデコード
-		err := json.Unmarshal(scanner.Bytes(), servicelog)
-		if err != nil {
-			slog.Warn("Error decoding JSON", slog.Any("error", err))
-			continue
-		}
-		lastUpdated = servicelog.Time
-		logs = append(logs, servicelog)
-
-		// 直近のログ
-		now := time.Now()
-		diff := now.Sub(servicelog.Time)
-		if diff <= o.config.LatestTimeRange.Duration {
-			latestLogs = append(latestLogs, servicelog)
-		}
+// status はもっとも悪いステータスを返す
+func (c *statusCount) status() *statusText {
+	switch {
+	case c.outage > 0:
+		return Outage
+	case c.degraded > 0:
+		return Degraded
+	case c.maintenance > 0:
+		return MaintenanceStatus
+	case c.operational > 0:
+		return Operational
 	}
-	// エラーチェック
-	if err := scanner.Err(); err != nil {
-		slog.Warn("Error reading file", slog.Any("error", err))
+	return NoDATA
+}
+
+func inMaintenance(windows []*Maintenance, t time.Time) bool {
+	for _, m := range windows {
+		if m.covers(t) {
+			return true
+		}
 	}
+	return false
+}
 
-	return lastUpdated, logs, latestLogs, nil
+// statusOf maps the result of a check to the status, taking maintenance windows into account
+func (s *Service) statusOf(code int, t time.Time) *statusText {
+	return s.statusIn(code, t, s.maintenances)
 }
 
-func sameCommand(c []string, s []string) bool {
-	if len(c) != len(s) {
-		return false
+// statusIn is statusOf with the given maintenance windows of the service
+func (s *Service) statusIn(code int, t time.Time, windows []*Maintenance) *statusText {
+	status := s.statusByCode(code)
+	if !status.IsOperational() && inMaintenance(windows, t) {
+		// メンテナンス中の失敗はOutageとして数えない
+		return MaintenanceStatus
 	}
-	for i := len(c) - 1; i >= 0; i-- {
-		if c[i] != s[i] {
-			return false
-		}
+	return status
+}
+
+func (s *Service) matches(serviceID, categoryName, name string, command []string) bool {
+	// IDを持つログはIDだけで一致させる
+	if serviceID != "" {
+		return serviceID == s.ID
 	}
-	return true
+	// IDを持たないログは、カテゴリ名とサービス名が一致 or コマンドが一緒する行を対象とする
+	// コマンドを持たないチェック(http等)はコマンドでは一致させない
+	return (categoryName == s.categoryName && name == s.Name) ||
+		(len(s.Command) > 0 && sameCommand(command, s.Command))
 }
 
-func (o *Opt) countByService(logs []*ServiceLog, service *Service) (int, int) {
-	ok := 0
-	fail := 0
-	for _, log := range logs {
-		// カテゴリ名とサービス名が一致 or コマンドが一緒する行を対象とする
-		if (log.CategoryName == service.categoryName && log.Name == service.Name) ||
-			sameCommand(log.Command, service.Command) {
-			if log.Status == 0 {
-				ok++
-			} else {
-				fail++
-			}
+type serviceStatus struct {
+	latestStatus   *statusText
+	latestStatusAt time.Time
+	statusHistory  []*statusText
+	uptimeHistory  []Uptime
+	uptime         UptimeSummary
+	latency        Latency
+	timeline       []*timelineDay
+	maintenances   []*Maintenance
+}
+
+type categoryStatus struct {
+	latestStatus  *statusText
+	uptimeHistory []Uptime
+	uptime        UptimeSummary
+}
+
+// statusSnapshot is the result of aggregating the logs for a configuration
+type statusSnapshot struct {
+	services              map[*Service]*serviceStatus
+	categories            map[*Category]*categoryStatus
+	days                  []string
+	dates                 []time.Time
+	incidents             []*Incident
+	scheduledMaintenances []*Maintenance
+}
+
+// loadLog aggregates the logs in the index. conf is not modified, so that readers are not blocked
+func (o *Opt) loadLog(_ context.Context, conf *Config, windows []*Maintenance) *statusSnapshot {
+	now := time.Now()
+	snapshot := &statusSnapshot{
+		services:              map[*Service]*serviceStatus{},
+		categories:            map[*Category]*categoryStatus{},
+		scheduledMaintenances: []*Maintenance{},
+	}
+	for _, m := range windows {
+		if m.End.After(now) {
+			snapshot.scheduledMaintenances = append(snapshot.scheduledMaintenances, m)
 		}
 	}
-	return ok, fail
-}
+	slices.SortFunc(snapshot.scheduledMaintenances, func(a, b *Maintenance) int {
+		return a.Start.Compare(b.Start)
+	})
 
-func (o *Opt) loadLog(ctx context.Context) {
-	d := time.Now()
-	days := make([]string, 0, 10)
-	days = append(days, o.config.LatestTimeRange.ShortString())
+	historyDays := conf.HistoryDays
+	// 履歴とuptimeを集計する期間のうち長いほうまで読む
+	loadDays := max(historyDays, uptimeRanges[len(uptimeRanges)-1])
+	// サービスごと、期間ごとの件数
+	serviceCounts := map[*Service][]*statusCount{}
+	durations := map[*Service][]float64{}
 
 	// initilize
-	for _, categeory := range o.config.Categories {
+	for _, categeory := range conf.Categories {
+		snapshot.categories[categeory] = &categoryStatus{uptimeHistory: make([]Uptime, historyDays)}
 		for _, service := range categeory.Services {
-			service.LatestStatus = NoDATA
-			service.LatestStatusAt = time.Now()
-			history := []*statusText{NoDATA, NoDATA, NoDATA, NoDATA, NoDATA, NoDATA, NoDATA}
-			service.StatusHistory = history
+			st := &serviceStatus{
+				latestStatus:   NoDATA,
+				latestStatusAt: now,
+				statusHistory:  make([]*statusText, historyDays),
+				uptimeHistory:  make([]Uptime, historyDays),
+				maintenances:   []*Maintenance{},
+			}
+			for _, m := range windows {
+				if m.affects(service) {
+					st.maintenances = append(st.maintenances, m)
+				}
+			}
+			for i := range st.statusHistory {
+				st.statusHistory[i] = NoDATA
+			}
+			snapshot.services[service] = st
+			serviceCounts[service] = []*statusCount{{}, {}, {}}
 		}
 	}
-	for i := 0; i < 7; i++ {
+
+	days := make([]string, 0, historyDays+1)
+	days = append(days, conf.LatestTimeRange.ShortString())
+	dates := make([]string, 0, historyDays)
+	snapshot.dates = make([]time.Time, 0, historyDays)
+	d := now
+	for i := 0; i < historyDays; i++ {
 		days = append(days, d.Format("01/02"))
-		lastUpdated, logs, latestLogs, err := o.loadServiceLog(ctx, d)
-		d = d.Add(-1 * time.Hour * 24)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			slog.Warn("failed to loadlog", slog.Any("error", err))
-			continue
-		}
-		if i == 0 {
-			// latestをいれる
-			for _, categeory := range o.config.Categories {
+		dates = append(dates, d.Format("2006-01-02"))
+		snapshot.dates = append(snapshot.dates, d)
+		d = d.AddDate(0, 0, -1)
+	}
+	snapshot.days = days
+
+	o.index.view(o.logStore(), now, loadDays, func(summaries []*daySummary) {
+		for i, summary := range summaries {
+			if summary == nil {
+				continue
+			}
+			summary.mapServices(conf)
+			for _, categeory := range conf.Categories {
+				categoryCount := &statusCount{}
 				for _, service := range categeory.Services {
-					ok, fail := o.countByService(latestLogs, service)
-					service.LatestStatusAt = lastUpdated
-					if ok == 0 && fail == 0 {
-						service.LatestStatus = NoDATA
-					} else if fail > 0 {
-						service.LatestStatus = Outage
-					} else {
-						service.LatestStatus = Operational
+					st := snapshot.services[service]
+					if i == 0 {
+						// latestをいれる
+						st.latestStatus = summary.countSince(service, st.maintenances, now.Add(-conf.LatestTimeRange.Duration)).status()
+					}
+					count := summary.count(service, st.maintenances)
+					for r, n := range uptimeRanges {
+						if i < n {
+							serviceCounts[service][r].merge(count)
+						}
+					}
+					if i < latencyDays {
+						durations[service] = append(durations[service], summary.durations(service)...)
+					}
+					if i >= historyDays {
+						continue
 					}
+					categoryCount.merge(count)
+					st.statusHistory[i] = count.status()
+					st.uptimeHistory[i] = count.uptime()
+					st.latestStatusAt = summary.lastUpdated
 				}
-			}
-		}
-		for _, categeory := range o.config.Categories {
-			for _, service := range categeory.Services {
-				ok, fail := o.countByService(logs, service)
-				service.LatestStatusAt = lastUpdated
-				if ok == 0 && fail == 0 {
-					service.StatusHistory[i] = NoDATA
-				} else if fail > 0 {
-					service.StatusHistory[i] = Outage
-				} else {
-					service.StatusHistory[i] = Operational
+				if i < historyDays {
+					snapshot.categories[categeory].uptimeHistory[i] = categoryCount.uptime()
 				}
 			}
 		}
-	}
+	})
 
-	for _, categeory := range o.config.Categories {
-		ok := 0
-		fail := 0
-		nodata := 0
+	for _, categeory := range conf.Categories {
+		count := &statusCount{}
+		categoryCounts := []*statusCount{{}, {}, {}}
 		for _, service := range categeory.Services {
-			if service.LatestStatus.IsOperational() {
-				ok++
-			} else if service.LatestStatus.IsOutage() {
-				fail++
-			} else {
-				nodata++
+			st := snapshot.services[service]
+			count.add(st.latestStatus)
+			for r := range uptimeRanges {
+				categoryCounts[r].merge(serviceCounts[service][r])
 			}
+			st.uptime = newUptimeSummary(serviceCounts[service])
+			st.latency = newLatency(durations[service])
+			st.timeline = newTimeline(dates, st.statusHistory, st.uptimeHistory)
 		}
-		categeory.LatestStatus = NoDATA
-		if fail == 0 && ok > 0 {
-			categeory.LatestStatus = Operational
-		} else if fail > 0 {
-			categeory.LatestStatus = Outage
-		}
+		snapshot.categories[categeory].latestStatus = count.status()
+		snapshot.categories[categeory].uptime = newUptimeSummary(categoryCounts)
 	}
 
-	o.config.Days = days
-	o.config.LastUpdatedAt = time.Now()
+	// 未解決のインシデントと履歴の期間内に解決したインシデント
+	snapshot.incidents = []*Incident{}
+	if o.incidents != nil {
+		snapshot.incidents = o.incidents.list(now.AddDate(0, 0, -historyDays))
+	}
+	return snapshot
+}
+
+// apply sets the aggregated values to the configuration. must be called with the write lock held
+func (snapshot *statusSnapshot) apply(conf *Config) {
+	for _, categeory := range conf.Categories {
+		cs, ok := snapshot.categories[categeory]
+		if !ok {
+			continue
+		}
+		categeory.LatestStatus = cs.latestStatus
+		categeory.UptimeHistory = cs.uptimeHistory
+		categeory.Uptime = cs.uptime
+		for _, service := range categeory.Services {
+			st := snapshot.services[service]
+			service.LatestStatus = st.latestStatus
+			service.LatestStatusAt = st.latestStatusAt
+			service.StatusHistory = st.statusHistory
+			service.UptimeHistory = st.uptimeHistory
+			service.Uptime = st.uptime
+			service.Latency = st.latency
+			service.Timeline = st.timeline
+			service.maintenances = st.maintenances
+		}
+	}
+	conf.ScheduledMaintenances = snapshot.scheduledMaintenances
+	conf.Incidents = snapshot.incidents
+	conf.Days = snapshot.days
+	conf.dates = snapshot.dates
+	conf.LastUpdatedAt = time.Now()
 }
 
 func (o *Opt) renderStatusPage(ctx context.Context) error {
-	r := template.Must(template.New("index").Parse(string(indexhtml)))
+	// 描画は同時に1つだけ行い、集計とテンプレートの実行は読み込みをブロックしない
+	o.renderMu.Lock()
+	defer o.renderMu.Unlock()
+	start := time.Now()
+	defer func() { o.metrics.observeRender(time.Since(start)) }()
+
+	o.rwlock.RLock()
+	conf := o.config
+	windows := o.maintenanceWindows()
+	o.rwlock.RUnlock()
+
+	snapshot := o.loadLog(ctx, conf, windows)
+
 	o.rwlock.Lock()
-	defer o.rwlock.Unlock()
-	o.loadLog(ctx)
-	w := &bytes.Buffer{}
-	err := r.ExecuteTemplate(w, "index", o.config)
-	if err != nil {
-		return err
+	snapshot.apply(conf)
+	o.rwlock.Unlock()
+
+	// accept_language の場合は言語ごとに描画しておく
+	blobs := map[string][]byte{}
+	o.rwlock.RLock()
+	for _, l := range conf.locales() {
+		w := &bytes.Buffer{}
+		if err := conf.template(l.key).ExecuteTemplate(w, "index", conf); err != nil {
+			o.rwlock.RUnlock()
+			return err
+		}
+		blobs[l.key] = w.Bytes()
 	}
-	o.htmlBlob = w.Bytes()
+	o.rwlock.RUnlock()
+	o.rwlock.Lock()
+	o.htmlBlob = blobs[""]
+	o.htmlBlobs = blobs
+	o.rwlock.Unlock()
 	return nil
 }
@@ -80,36 +80,48 @@ func TestCreateAndAppendServiceLog(t *testing.T) {
 	}
 }
 
-func TestLoadServiceLog(t *testing.T) {
+// countOfDay counts the results of the service on the day in the index, as loadLog does
+func countOfDay(opt *Opt, service *Service, d time.Time) *statusCount {
+	count := &statusCount{}
+	opt.index.peek(opt.logStore(), d, 1, func(days []*daySummary) {
+		if days[0] != nil {
+			count = days[0].count(service, nil)
+		}
+	})
+	return count
+}
+
+func (c *statusCount) total() int {
+	return c.operational + c.degraded + c.outage + c.maintenance
+}
+
+func TestLogIndex_LoadDay(t *testing.T) {
 	opt := newTestOpt(t)
+	service := opt.config.Categories[0].Services[0]
 	now := time.Now()
 	logs := []*ServiceLog{
 		{Time: now.Add(-1 * time.Hour), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 0},
 		{Time: now.Add(-30 * time.Minute), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 1},
 	}
-	day := now.Format("20060102")
-	writeServiceLog(t, opt.Data, logs, day)
-	_, all, latest, err := opt.loadServiceLog(context.Background(), now)
-	if err != nil {
-		t.Fatalf("loadServiceLog failed: %v", err)
-	}
-	if len(all) != 2 {
-		t.Errorf("all logs = %d, want 2", len(all))
-	}
-	if len(latest) != 2 {
-		t.Errorf("latest logs = %d, want 2", len(latest))
+	writeServiceLog(t, opt.Data, logs, dayOf(now))
+	if count := countOfDay(opt, service, now); count.operational != 1 || count.outage != 1 {
+		t.Errorf("count = %+v, want 1 operational and 1 outage", count)
 	}
+	// 直近の結果は当日の分だけ時刻付きで持つ
+	opt.index.peek(opt.logStore(), now, 1, func(days []*daySummary) {
+		if count := days[0].countSince(service, nil, now.Add(-opt.config.LatestTimeRange.Duration)); count.total() != 2 {
+			t.Errorf("latest = %+v, want 2 results", count)
+		}
+	})
 }
 
-func TestLoadServiceLog_FileNotFound(t *testing.T) {
+func TestLogIndex_FileNotFound(t *testing.T) {
 	opt := newTestOpt(t)
-	_, all, latest, err := opt.loadServiceLog(context.Background(), time.Now().AddDate(0, 0, -10))
-	if err == nil {
-		t.Fatal("expected error for missing log file")
-	}
-	if len(all) != 0 || len(latest) != 0 {
-		t.Errorf("logs should be empty on file not found")
-	}
+	opt.index.peek(opt.logStore(), time.Now().AddDate(0, 0, -10), 1, func(days []*daySummary) {
+		if days[0] != nil {
+			t.Errorf("day without the log file should be nil")
+		}
+	})
 }
 
 func TestSameCommand(t *testing.T) {
@@ -125,16 +137,35 @@ func TestSameCommand(t *testing.T) {
 }
 
 func TestCountByService(t *testing.T) {
-	opt := newTestOpt(t)
 	service := &Service{Name: "Google", categoryName: "Web", Command: []string{"ping", "google.com"}}
 	logs := []*ServiceLog{
 		{Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 0},
 		{Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 1},
 		{Name: "Other", CategoryName: "Web", Command: []string{"ping", "other.com"}, Status: 0},
 	}
-	ok, fail := opt.countByService(logs, service)
-	if ok != 1 || fail != 1 {
-		t.Errorf("countByService = %d ok, %d fail; want 1 ok, 1 fail", ok, fail)
+	count := summarizeLogs(logs, time.Now()).count(service, nil)
+	if count.operational != 1 || count.outage != 1 {
+		t.Errorf("count = %d ok, %d fail; want 1 ok, 1 fail", count.operational, count.outage)
+	}
+}
+
+func TestCountByService_Degraded(t *testing.T) {
+	service := &Service{Name: "Batch", categoryName: "Jobs", Command: []string{"check_batch"}, DegradedExitCodes: []int{1}}
+	logs := []*ServiceLog{
+		{Name: "Batch", CategoryName: "Jobs", Command: []string{"check_batch"}, Status: 0},
+		{Name: "Batch", CategoryName: "Jobs", Command: []string{"check_batch"}, Status: 1},
+	}
+	count := summarizeLogs(logs, time.Now()).count(service, nil)
+	if count.operational != 1 || count.degraded != 1 || count.outage != 0 {
+		t.Errorf("count = %+v; want 1 operational, 1 degraded", count)
+	}
+	if count.status() != Degraded {
+		t.Errorf("status = %v, want Degraded", count.status())
+	}
+
+	logs = append(logs, &ServiceLog{Name: "Batch", CategoryName: "Jobs", Command: []string{"check_batch"}, Status: 2})
+	if status := summarizeLogs(logs, time.Now()).count(service, nil).status(); status != Outage {
+		t.Errorf("status = %v, want Outage", status)
 	}
 }
 
@@ -168,6 +199,34 @@ func TestLoadLogAndRenderStatusPage(t *testing.T) {
 	}
 }
 
+func TestLoadLog_Degraded(t *testing.T) {
+	opt := newTestOpt(t)
+	svc := opt.config.Categories[0].Services[0]
+	svc.DegradedExitCodes = []int{1}
+	now := time.Now()
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: now.Add(-10 * time.Minute), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 0},
+		{Time: now.Add(-5 * time.Minute), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 1},
+	}, now.Format("20060102"))
+
+	err := opt.renderStatusPage(context.Background())
+	if err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	if svc.LatestStatus != Degraded {
+		t.Errorf("LatestStatus = %v, want Degraded", svc.LatestStatus)
+	}
+	if svc.StatusHistory[0] != Degraded {
+		t.Errorf("StatusHistory[0] = %v, want Degraded", svc.StatusHistory[0])
+	}
+	if opt.config.Categories[0].LatestStatus != Degraded {
+		t.Errorf("Category.LatestStatus = %v, want Degraded", opt.config.Categories[0].LatestStatus)
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte("fa-exclamation-circle")) {
+		t.Errorf("htmlBlob does not contain the degraded icon")
+	}
+}
+
 func TestLoadLog_NoLogs(t *testing.T) {
 	opt := newTestOpt(t)
 	err := opt.renderStatusPage(context.Background())
@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
@@ -18,14 +19,34 @@ import (
 var version string
 
 type Opt struct {
-	Listen   string `short:"l" long:"listen" default:":8080" description:"address:port to bind"`
-	Toml     string `long:"toml" description:"file path to toml file" required:"true"`
-	Data     string `long:"data" description:"file path to data dir" required:"true"`
-	Version  bool   `short:"v" long:"version" description:"Show version"`
-	Check    bool   `long:"check" description:"Run syntax check for configuration"`
-	config   *Config
-	htmlBlob []byte
-	rwlock   sync.RWMutex
+	Listen       string `short:"l" long:"listen" default:":8080" description:"address:port to bind"`
+	Toml         string `long:"toml" description:"file path to toml file" required:"true"`
+	Data         string `long:"data" description:"file path to data dir" required:"true"`
+	Version      bool   `short:"v" long:"version" description:"Show version"`
+	Check        bool   `long:"check" description:"Run syntax check for configuration"`
+	Strict       bool   `long:"strict" description:"Fail --check on warnings too"`
+	Format       string `long:"format" default:"text" choice:"text" choice:"json" description:"output format of --check and --once"`
+	Once         bool   `long:"once" description:"Run the checks once, print the results and exit"`
+	Service      string `long:"service" description:"category/name or id of the service to check with --once"`
+	DryRun       bool   `long:"dry-run" description:"Do not write the results of --once to the data dir"`
+	AdminToken   string `long:"admin-token" env:"STATUSBOARD_ADMIN_TOKEN" description:"bearer token to enable the admin API"`
+	Watch        bool   `long:"watch" description:"Reload configuration when the toml file is changed"`
+	Storage      string `long:"storage" default:"file" choice:"file" choice:"sqlite" description:"storage backend of check results"`
+	MigrateIDs   bool   `long:"migrate-ids" description:"Write the ids of the services to the existing logs and exit"`
+	config       *Config
+	htmlBlob     []byte
+	htmlBlobs    map[string][]byte
+	rwlock       sync.RWMutex
+	incidents    *incidentStore
+	maintenances *maintenanceStore
+	notifier     *notifier
+	metrics      *metrics
+	health       workerHealth
+	reloaded     chan struct{}
+	index        logIndex
+	store        logStore
+	renderMu     sync.Mutex
+	feedCache    feedCache
 }
 
 func printVersion() {
@@ -48,6 +69,8 @@ func StatusText(s string) *statusText {
 
 var NoDATA = StatusText("NoData")
 var Outage = StatusText("Outage")
+var Degraded = StatusText("Degraded")
+var MaintenanceStatus = StatusText("Maintenance")
 var Operational = StatusText("Operational")
 
 func (s *statusText) MarshalJSON() ([]byte, error) {
@@ -66,6 +89,14 @@ func (s *statusText) IsOutage() bool {
 	return s == Outage
 }
 
+func (s *statusText) IsDegraded() bool {
+	return s == Degraded
+}
+
+func (s *statusText) IsMaintenance() bool {
+	return s == MaintenanceStatus
+}
+
 func _main() int {
 	opt := &Opt{}
 	psr := flags.NewParser(opt, flags.HelpFlag|flags.PassDoubleDash)
@@ -78,18 +109,35 @@ func _main() int {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
+	if opt.Check {
+		return opt.checkConfig()
+	}
 	conf, err := loadToml(opt.Toml)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
 	opt.config = conf
+	// 日の区切りと表示する時刻は timezone に合わせる。他のgoroutineを起動する前に設定する
+	if conf.location != nil {
+		time.Local = conf.location
+	}
 
-	if opt.Check {
-		fmt.Fprint(os.Stdout, "syntax OK\n")
-		return 0
+	if opt.Once {
+		ctx, done := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer done()
+		return opt.checkOnce(ctx)
 	}
 
+	opt.metrics = newMetrics()
+
+	opt.store, err = newLogStore(opt.Storage, opt.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer opt.store.Close()
+
 	// check open file in data dir
 	err = opt.createServiceLog()
 	if err != nil {
@@ -97,6 +145,27 @@ func _main() int {
 		return 1
 	}
 
+	if opt.MigrateIDs {
+		n, err := opt.migrateIDs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stdout, "%d logs migrated\n", n)
+		return 0
+	}
+
+	opt.incidents, err = loadIncidentStore(opt.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	opt.maintenances, err = loadMaintenanceStore(opt.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
 	// render html
 	err = opt.renderStatusPage(context.Background())
 	if err != nil {
@@ -109,6 +178,18 @@ func _main() int {
 	defer done()
 	g, ctx := errgroup.WithContext(ctx)
 
+	// 再読み込みで通知先が追加されることもあるので常に起動しておく
+	opt.notifier = newNotifier(conf.Notification)
+	g.Go(func() error {
+		return opt.notifier.run(ctx)
+	})
+	opt.reloaded = make(chan struct{}, 1)
+	g.Go(func() error {
+		return opt.watchReload(ctx)
+	})
+	g.Go(func() error {
+		return opt.runJanitor(ctx)
+	})
 	g.Go(func() error {
 		return opt.startWorker(ctx)
 	})
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v5"
+	"github.com/pkg/errors"
+)
+
+// Maintenance is a scheduled maintenance window. failures of the affected
+// services inside the window are not counted as Outage.
+type Maintenance struct {
+	ID          int       `toml:"-" json:"id"`
+	Start       time.Time `toml:"start" json:"start"`
+	End         time.Time `toml:"end" json:"end"`
+	Description string    `toml:"description" json:"description"`
+	Affected
+}
+
+// affects reports whether the window applies to the service. no categories and services means all services
+func (m *Maintenance) affects(service *Service) bool {
+	return m.Affected.IsEmpty() || m.includes(service)
+}
+
+func (m *Maintenance) covers(t time.Time) bool {
+	return !t.Before(m.Start) && t.Before(m.End)
+}
+
+func (m *Maintenance) IsActive() bool {
+	return m.covers(time.Now())
+}
+
+func (m *Maintenance) validate(conf *Config) error {
+	if m.Start.IsZero() || m.End.IsZero() {
+		return errors.New("start and end are required")
+	}
+	if !m.End.After(m.Start) {
+		return errors.New("end must be after start")
+	}
+	return m.Affected.validate(conf)
+}
+
+// maintenanceStore keeps windows created via the admin API and persists them to maintenances.json in the data dir
+type maintenanceStore struct {
+	path         string
+	mu           sync.RWMutex
+	maintenances []*Maintenance
+}
+
+func loadMaintenanceStore(dir string) (*maintenanceStore, error) {
+	s := &maintenanceStore{
+		path:         filepath.Join(dir, "maintenances.json"),
+		maintenances: []*Maintenance{},
+	}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read maintenances")
+	}
+	if err := json.Unmarshal(b, &s.maintenances); err != nil {
+		return nil, errors.Wrap(err, "failed to decode maintenances")
+	}
+	return s, nil
+}
+
+func (s *maintenanceStore) list() []*Maintenance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.maintenances)
+}
+
+func (s *maintenanceStore) create(m *Maintenance) (*Maintenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.ID = 1
+	if len(s.maintenances) > 0 {
+		m.ID = s.maintenances[len(s.maintenances)-1].ID + 1
+	}
+	maintenances := append(slices.Clone(s.maintenances), m)
+	if err := writeJSONFile(s.path, maintenances); err != nil {
+		return nil, err
+	}
+	s.maintenances = maintenances
+	return m, nil
+}
+
+func (s *maintenanceStore) delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.maintenances, func(m *Maintenance) bool { return m.ID == id })
+	if idx < 0 {
+		return os.ErrNotExist
+	}
+	maintenances := slices.Delete(slices.Clone(s.maintenances), idx, idx+1)
+	if err := writeJSONFile(s.path, maintenances); err != nil {
+		return err
+	}
+	s.maintenances = maintenances
+	return nil
+}
+
+// maintenanceWindows returns the windows from the configuration and the admin API
+func (o *Opt) maintenanceWindows() []*Maintenance {
+	windows := slices.Clone(o.config.Maintenance)
+	if o.maintenances != nil {
+		windows = append(windows, o.maintenances.list()...)
+	}
+	return windows
+}
+
+func (o *Opt) handleListMaintenances(c *echo.Context) error {
+	o.rwlock.RLock()
+	windows := o.maintenanceWindows()
+	o.rwlock.RUnlock()
+	return c.JSON(http.StatusOK, windows)
+}
+
+func (o *Opt) handleCreateMaintenance(c *echo.Context) error {
+	m := &Maintenance{}
+	if err := c.Bind(m); err != nil {
+		return err
+	}
+	o.rwlock.RLock()
+	err := m.validate(o.config)
+	o.rwlock.RUnlock()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	m, err = o.maintenances.create(m)
+	if err != nil {
+		return err
+	}
+	if err := o.renderStatusPage(c.Request().Context()); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, m)
+}
+
+func (o *Opt) handleDeleteMaintenance(c *echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "maintenance not found")
+	}
+	err = o.maintenances.delete(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return echo.NewHTTPError(http.StatusNotFound, "maintenance not found")
+	}
+	if err != nil {
+		return err
+	}
+	if err := o.renderStatusPage(c.Request().Context()); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
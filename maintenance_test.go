@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoadToml_Maintenance(t *testing.T) {
+	tomlContent := `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "Top"
+  command = ["true"]
+
+[[maintenance]]
+start = 2026-10-18T02:00:00+09:00
+end = 2026-10-18T04:00:00+09:00
+description = "DB upgrade"
+services = ["Top"]
+`
+	conf, err := loadToml(writeTempToml(t, tomlContent))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	if len(conf.Maintenance) != 1 {
+		t.Fatalf("Maintenance len = %d, want 1", len(conf.Maintenance))
+	}
+	m := conf.Maintenance[0]
+	if m.End.Sub(m.Start) != 2*time.Hour || m.Description != "DB upgrade" {
+		t.Errorf("Maintenance = %+v", m)
+	}
+	if !m.affects(conf.Categories[0].Services[0]) {
+		t.Errorf("maintenance should affect the service")
+	}
+
+	invalid := map[string]string{
+		"end before start": `
+[[maintenance]]
+start = 2026-10-18T04:00:00+09:00
+end = 2026-10-18T02:00:00+09:00
+`,
+		"unknown service": `
+[[maintenance]]
+start = 2026-10-18T02:00:00+09:00
+end = 2026-10-18T04:00:00+09:00
+services = ["Unknown"]
+`,
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadToml(writeTempToml(t, content)); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadLog_Maintenance(t *testing.T) {
+	opt := newTestOpt(t)
+	now := time.Now()
+	svc := opt.config.Categories[0].Services[0]
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: now.Add(-20 * time.Minute), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 0},
+		{Time: now.Add(-10 * time.Minute), Name: "Google", CategoryName: "Web", Command: []string{"ping", "google.com"}, Status: 1},
+	}, now.Format("20060102"))
+
+	// 失敗がメンテナンス中なのでOutageにならない
+	opt.config.Maintenance = []*Maintenance{
+		{Start: now.Add(-15 * time.Minute), End: now.Add(time.Hour), Description: "upgrade", Affected: Affected{Categories: []string{"Web"}}},
+	}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	if svc.LatestStatus != MaintenanceStatus {
+		t.Errorf("LatestStatus = %v, want Maintenance", svc.LatestStatus)
+	}
+	if svc.StatusHistory[0] != MaintenanceStatus {
+		t.Errorf("StatusHistory[0] = %v, want Maintenance", svc.StatusHistory[0])
+	}
+	if opt.config.Categories[0].LatestStatus != MaintenanceStatus {
+		t.Errorf("Category.LatestStatus = %v, want Maintenance", opt.config.Categories[0].LatestStatus)
+	}
+	if len(opt.config.ScheduledMaintenances) != 1 || !bytes.Contains(opt.htmlBlob, []byte("Maintenance in progress")) {
+		t.Errorf("active maintenance is not shown")
+	}
+
+	// 他のサービスのメンテナンスは影響しない
+	opt.config.Maintenance[0].Affected = Affected{Services: []string{"Other"}}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	if svc.LatestStatus != Outage {
+		t.Errorf("LatestStatus = %v, want Outage", svc.LatestStatus)
+	}
+}
+
+func TestMaintenanceAdminAPI(t *testing.T) {
+	opt := newTestOpt(t)
+	opt.AdminToken = "secret"
+	var err error
+	if opt.incidents, err = loadIncidentStore(opt.Data); err != nil {
+		t.Fatal(err)
+	}
+	if opt.maintenances, err = loadMaintenanceStore(opt.Data); err != nil {
+		t.Fatal(err)
+	}
+	e := opt.buildHandler()
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	rec := adminRequest(t, e, http.MethodPost, "/_admin/maintenances", "secret", map[string]any{
+		"start": start, "end": start.Add(-time.Hour),
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for end before start", rec.Code)
+	}
+	rec = adminRequest(t, e, http.MethodPost, "/_admin/maintenances", "secret", map[string]any{
+		"start": start, "end": start.Add(2 * time.Hour), "description": "Sunday maintenance <b>", "services": []string{"Google"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte("Scheduled maintenance")) || !bytes.Contains(opt.htmlBlob, []byte("Sunday maintenance")) {
+		t.Errorf("htmlBlob does not contain the scheduled maintenance")
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte("Sunday maintenance &lt;b&gt;")) || bytes.Contains(opt.htmlBlob, []byte("<b>")) {
+		t.Errorf("description should be escaped")
+	}
+
+	// reload from the data dir
+	store, err := loadMaintenanceStore(opt.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if windows := store.list(); len(windows) != 1 || !windows[0].Start.Equal(start) {
+		t.Errorf("stored maintenances = %+v", windows)
+	}
+
+	rec = adminRequest(t, e, http.MethodDelete, "/_admin/maintenances/1", "secret", nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", rec.Code)
+	}
+	rec = adminRequest(t, e, http.MethodDelete, "/_admin/maintenances/1", "secret", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if len(opt.config.ScheduledMaintenances) != 0 {
+		t.Errorf("deleted maintenance is still scheduled")
+	}
+}
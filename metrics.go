@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gammazero/workerpool"
+	"github.com/labstack/echo/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var serviceStatuses = []*statusText{NoDATA, Outage, Degraded, MaintenanceStatus, Operational}
+
+// metrics holds the prometheus collectors. all methods are no-op on nil
+type metrics struct {
+	registry *prometheus.Registry
+	pool     atomic.Pointer[workerpool.WorkerPool]
+
+	serviceStatus  *prometheus.GaugeVec
+	lastCheck      *prometheus.GaugeVec
+	lastExitCode   *prometheus.GaugeVec
+	lastDuration   *prometheus.GaugeVec
+	checkRuns      *prometheus.CounterVec
+	checkFailures  *prometheus.CounterVec
+	checkTimeouts  *prometheus.CounterVec
+	checkRetries   *prometheus.CounterVec
+	renderDuration prometheus.Histogram
+	httpRequests   *prometheus.CounterVec
+	httpDuration   *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	serviceLabels := []string{"category", "service"}
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		serviceStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "statusboard_service_status",
+			Help: "Current status of the service. 1 for the current status, 0 for the others.",
+		}, append(serviceLabels, "status")),
+		lastCheck: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "statusboard_service_last_check_timestamp_seconds",
+			Help: "Unix time of the last check of the service.",
+		}, serviceLabels),
+		lastExitCode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "statusboard_service_last_exit_code",
+			Help: "Exit code of the last check of the service.",
+		}, serviceLabels),
+		lastDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "statusboard_service_last_check_duration_seconds",
+			Help: "Duration of the last check of the service including retries.",
+		}, serviceLabels),
+		checkRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "statusboard_check_runs_total",
+			Help: "Number of check attempts.",
+		}, serviceLabels),
+		checkFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "statusboard_check_failures_total",
+			Help: "Number of check attempts resulted in Outage.",
+		}, serviceLabels),
+		checkTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "statusboard_check_timeouts_total",
+			Help: "Number of checks exceeded worker_timeout.",
+		}, serviceLabels),
+		checkRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "statusboard_check_retries_total",
+			Help: "Number of check attempts retried after a failure.",
+		}, serviceLabels),
+		renderDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "statusboard_render_duration_seconds",
+			Help:    "Duration of rendering the status page.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "statusboard_http_requests_total",
+			Help: "Number of HTTP requests.",
+		}, []string{"method", "path", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "statusboard_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "path"}),
+	}
+	m.registry.MustRegister(
+		m.serviceStatus,
+		m.lastCheck,
+		m.lastExitCode,
+		m.lastDuration,
+		m.checkRuns,
+		m.checkFailures,
+		m.checkTimeouts,
+		m.checkRetries,
+		m.renderDuration,
+		m.httpRequests,
+		m.httpDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "statusboard_worker_queue_depth",
+			Help: "Number of checks waiting for a worker.",
+		}, func() float64 {
+			pool := m.pool.Load()
+			if pool == nil {
+				return 0
+			}
+			return float64(pool.WaitingQueueSize())
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+func (m *metrics) setPool(pool *workerpool.WorkerPool) {
+	if m == nil {
+		return
+	}
+	m.pool.Store(pool)
+}
+
+// observeAttempt records an attempt of the check. retry is true for the second and later attempts
+func (m *metrics) observeAttempt(service *Service, status *statusText, retry bool) {
+	if m == nil {
+		return
+	}
+	m.checkRuns.WithLabelValues(service.categoryName, service.Name).Inc()
+	if status.IsOutage() {
+		m.checkFailures.WithLabelValues(service.categoryName, service.Name).Inc()
+	}
+	if retry {
+		m.checkRetries.WithLabelValues(service.categoryName, service.Name).Inc()
+	}
+}
+
+func (m *metrics) observeTimeout(service *Service) {
+	if m == nil {
+		return
+	}
+	m.checkTimeouts.WithLabelValues(service.categoryName, service.Name).Inc()
+}
+
+// observeCheck records the result of the check
+func (m *metrics) observeCheck(service *Service, status *statusText, code int, t time.Time, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	for _, s := range serviceStatuses {
+		v := 0.0
+		if s == status {
+			v = 1
+		}
+		m.serviceStatus.WithLabelValues(service.categoryName, service.Name, s.String()).Set(v)
+	}
+	m.lastCheck.WithLabelValues(service.categoryName, service.Name).Set(float64(t.UnixMilli()) / 1000)
+	m.lastExitCode.WithLabelValues(service.categoryName, service.Name).Set(float64(code))
+	m.lastDuration.WithLabelValues(service.categoryName, service.Name).Set(duration.Seconds())
+}
+
+// forgetServices deletes the series of services removed from the configuration
+func (m *metrics) forgetServices(old, conf *Config) {
+	if m == nil {
+		return
+	}
+	exists := map[string]bool{}
+	for _, category := range conf.Categories {
+		for _, service := range category.Services {
+			exists[serviceKey(service)] = true
+		}
+	}
+	for _, category := range old.Categories {
+		for _, service := range category.Services {
+			if exists[serviceKey(service)] {
+				continue
+			}
+			labels := prometheus.Labels{"category": category.Name, "service": service.Name}
+			for _, vec := range []*prometheus.MetricVec{
+				m.serviceStatus.MetricVec, m.lastCheck.MetricVec, m.lastExitCode.MetricVec, m.lastDuration.MetricVec,
+				m.checkRuns.MetricVec, m.checkFailures.MetricVec, m.checkTimeouts.MetricVec, m.checkRetries.MetricVec,
+			} {
+				vec.DeletePartialMatch(labels)
+			}
+		}
+	}
+}
+
+func (m *metrics) observeRender(duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.renderDuration.Observe(duration.Seconds())
+}
+
+// middleware records the HTTP requests. path is the route pattern to keep the cardinality low
+func (m *metrics) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		path := c.Path()
+		if path == "" {
+			path = "unmatched"
+		}
+		_, status := echo.ResolveResponseStatus(c.Response(), err)
+		m.httpRequests.WithLabelValues(c.Request().Method, path, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(c.Request().Method, path).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (m *metrics) handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	tomlContent := `
+[[category]]
+name = "Web"
+
+  [[category.service]]
+  name = "OK"
+  command = ["true"]
+
+  [[category.service]]
+  name = "NG"
+  command = ["sh", "-c", "exit 2"]
+  max_check_attempts = 2
+  retry_interval = "1ms"
+`
+	conf, err := loadToml(writeTempToml(t, tomlContent))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf, metrics: newMetrics()}
+	for _, service := range conf.Categories[0].Services {
+		opt.checkService(context.Background(), service)
+	}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+
+	e := opt.buildHandler()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/_json", nil))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`statusboard_service_status{category="Web",service="OK",status="Operational"} 1`,
+		`statusboard_service_status{category="Web",service="NG",status="Outage"} 1`,
+		`statusboard_service_status{category="Web",service="NG",status="Operational"} 0`,
+		`statusboard_service_last_exit_code{category="Web",service="NG"} 2`,
+		`statusboard_check_runs_total{category="Web",service="NG"} 2`,
+		`statusboard_check_failures_total{category="Web",service="NG"} 2`,
+		`statusboard_check_retries_total{category="Web",service="NG"} 1`,
+		`statusboard_check_runs_total{category="Web",service="OK"} 1`,
+		`statusboard_render_duration_seconds_count 1`,
+		`statusboard_http_requests_total{code="200",method="GET",path="/_json"} 1`,
+		`statusboard_worker_queue_depth 0`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// assignID sets the ids of the service with the same category and name to the log without ids.
+// commands are not used, because the logs of the services sharing a command cannot be told apart
+func (c *Config) assignID(categoryName, name string) (string, string, bool) {
+	service := c.findService(categoryName, name)
+	if service == nil || service.ID == "" {
+		return "", "", false
+	}
+	return service.categoryID, service.ID, true
+}
+
+// migrateIDs writes the ids of the services to the existing logs and summaries written before the ids are given.
+// returns the number of the updated logs. must not be run while another process writes the logs
+func (o *Opt) migrateIDs() (int, error) {
+	store := o.logStore()
+	logDays, summaryDays, err := store.days()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list logs")
+	}
+	migrated := 0
+	for _, day := range logDays {
+		logs, err := store.readDay(day)
+		if err != nil {
+			return migrated, errors.Wrapf(err, "failed to read logs of %s", day)
+		}
+		n := 0
+		for _, log := range logs {
+			if log.ServiceID != "" {
+				continue
+			}
+			if categoryID, serviceID, ok := o.config.assignID(log.CategoryName, log.Name); ok {
+				log.CategoryID, log.ServiceID = categoryID, serviceID
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if err := store.replaceDay(day, logs); err != nil {
+			return migrated, errors.Wrapf(err, "failed to write logs of %s", day)
+		}
+		migrated += n
+	}
+	for _, day := range summaryDays {
+		summary, err := store.readSummary(day)
+		if err != nil {
+			return migrated, errors.Wrapf(err, "failed to read summary of %s", day)
+		}
+		if summary == nil {
+			continue
+		}
+		changed := false
+		entries := map[string]*logEntry{}
+		for _, e := range summary.entries {
+			if e.ServiceID == "" {
+				if _, serviceID, ok := o.config.assignID(e.CategoryName, e.Name); ok {
+					e.ServiceID = serviceID
+					changed = true
+				}
+			}
+			// 同じサービスの集計をまとめる
+			if prev, ok := entries[e.key()]; ok {
+				prev.merge(e)
+			} else {
+				entries[e.key()] = e
+			}
+		}
+		if !changed {
+			continue
+		}
+		summary.entries = entries
+		if err := store.writeSummary(day, summary); err != nil {
+			return migrated, errors.Wrapf(err, "failed to write summary of %s", day)
+		}
+	}
+	return migrated, nil
+}
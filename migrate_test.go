@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadToml_IDs(t *testing.T) {
+	tests := []struct {
+		toml string
+		want string
+	}{
+		{`
+[[category]]
+id = "web"
+name = "Web"
+  [[category.service]]
+  id = "api"
+  name = "API"
+  command = ["true"]
+[[category]]
+id = "batch"
+name = "Batch"
+  [[category.service]]
+  name = "Nightly"
+  command = ["true"]
+`, ""},
+		{`
+[[category]]
+name = "Web"
+  [[category.service]]
+  id = "api"
+  name = "API"
+  command = ["true"]
+[[category]]
+name = "Batch"
+  [[category.service]]
+  id = "api"
+  name = "Nightly"
+  command = ["true"]
+`, `duplicate id "api"`},
+		{`
+[[category]]
+id = "web"
+name = "Web"
+[[category]]
+id = "web"
+name = "Batch"
+`, `duplicate id "web"`},
+		{`
+[[category]]
+name = "Web"
+  [[category.service]]
+  id = "api/v2"
+  name = "API"
+  command = ["true"]
+`, `id "api/v2"`},
+	}
+	for _, tt := range tests {
+		conf, err := loadToml(writeTempToml(t, tt.toml))
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("loadToml failed: %v", err)
+			} else if conf.Categories[0].Services[0].categoryID != "web" {
+				t.Errorf("categoryID = %q, want web", conf.Categories[0].Services[0].categoryID)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadToml error = %v, want %s", err, tt.want)
+		}
+	}
+}
+
+func matchLog(s *Service, log *ServiceLog) bool {
+	return s.matches(log.ServiceID, log.CategoryName, log.Name, log.Command)
+}
+
+func TestMatchLog_ID(t *testing.T) {
+	command := []string{"check", "db"}
+	primary := &Service{ID: "db-primary", categoryName: "DB", Name: "Primary", Command: command}
+	replica := &Service{ID: "db-replica", categoryName: "DB", Name: "Replica", Command: command}
+	legacy := &Service{categoryName: "DB", Name: "Legacy", Command: command}
+
+	withID := &ServiceLog{ServiceID: "db-primary", CategoryName: "DB", Name: "Renamed", Command: command}
+	if !matchLog(primary, withID) || matchLog(replica, withID) || matchLog(legacy, withID) {
+		t.Errorf("log with the id should match only the service with the id")
+	}
+	// IDを持たないログはこれまで通り名前かコマンドで一致させる
+	withoutID := &ServiceLog{CategoryName: "DB", Name: "Primary", Command: command}
+	if !matchLog(primary, withoutID) || !matchLog(replica, withoutID) || !matchLog(legacy, withoutID) {
+		t.Errorf("log without the id should match by the name or the command")
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	for _, storage := range []string{"file", "sqlite"} {
+		t.Run(storage, func(t *testing.T) {
+			opt := newTestOpt(t)
+			store, err := newLogStore(storage, opt.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if err := store.init(); err != nil {
+				t.Fatal(err)
+			}
+			opt.store = store
+
+			now := time.Now()
+			svc := opt.config.Categories[0].Services[0]
+			old := now.AddDate(0, 0, -10)
+			for _, log := range []*ServiceLog{
+				{Time: old, Name: "Google", CategoryName: "Web", Command: svc.Command, Status: 2},
+				{Time: now.AddDate(0, 0, -3), Name: "Google", CategoryName: "Web", Command: svc.Command, Status: 2},
+				{Time: now.AddDate(0, 0, -3), Name: "Other", CategoryName: "Web", Command: []string{"true"}, Status: 0},
+			} {
+				if err := store.append(log); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 古い日は集計だけにして、直近の日は圧縮する
+			opt.config.Retention = &Retention{RawDays: 7, CompressAfterDays: 1}
+			if err := opt.cleanupLogs(now); err != nil {
+				t.Fatal(err)
+			}
+			opt.config.Retention = nil
+
+			svc.ID = "google"
+			n, err := opt.migrateIDs()
+			if err != nil {
+				t.Fatalf("migrateIDs failed: %v", err)
+			}
+			if n != 1 {
+				t.Errorf("migrated = %d, want 1", n)
+			}
+			logs, err := store.readDay(now.AddDate(0, 0, -3).Format("20060102"))
+			if err != nil || len(logs) != 2 || logs[0].ServiceID != "google" || logs[1].ServiceID != "" {
+				t.Errorf("readDay = %+v, %v", logs, err)
+			}
+			if n, err := opt.migrateIDs(); err != nil || n != 0 {
+				t.Errorf("second migrateIDs = %d, %v, want 0", n, err)
+			}
+
+			// 移行後は名前とコマンドを変えても履歴が残る
+			svc.Name = "Google Search"
+			svc.Command = []string{"curl", "https://www.google.com/"}
+			opt.config.HistoryDays = 30
+			if err := opt.renderStatusPage(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if svc.StatusHistory[3] != Outage || svc.StatusHistory[10] != Outage {
+				t.Errorf("StatusHistory[3] = %v, [10] = %v, want Outage", svc.StatusHistory[3], svc.StatusHistory[10])
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+type Notification struct {
+	// number of consecutive results of a new status required before notifying
+	Consecutive int `toml:"consecutive"`
+	// minimum interval between notifications of a service, to suppress flapping
+	MinInterval   duration            `toml:"min_interval"`
+	RetryInterval duration            `toml:"retry_interval"`
+	MaxRetries    int                 `toml:"max_retries"`
+	Sinks         []*NotificationSink `toml:"sink"`
+}
+
+type NotificationSink struct {
+	Type    string            `toml:"type"`
+	URL     string            `toml:"url"`
+	Headers map[string]string `toml:"headers"`
+	Timeout duration          `toml:"timeout"`
+
+	// type = "email"
+	SMTPAddr     string   `toml:"smtp_addr"`
+	SMTPUsername string   `toml:"smtp_username"`
+	SMTPPassword string   `toml:"smtp_password"`
+	From         string   `toml:"from"`
+	To           []string `toml:"to"`
+}
+
+func (n *Notification) prepare() error {
+	if n.Consecutive == 0 {
+		n.Consecutive = 1
+	}
+	if n.RetryInterval.IsZero() {
+		n.RetryInterval = MustDuration("30s")
+	}
+	if n.MaxRetries == 0 {
+		n.MaxRetries = 3
+	}
+	for i, sink := range n.Sinks {
+		if sink.Timeout.IsZero() {
+			sink.Timeout = MustDuration("10s")
+		}
+		switch sink.Type {
+		case "webhook", "slack":
+			if sink.URL == "" {
+				return errors.Errorf("sink #%d (%s) has no url", i+1, sink.Type)
+			}
+		case "email":
+			if sink.SMTPAddr == "" || sink.From == "" || len(sink.To) == 0 {
+				return errors.Errorf("sink #%d (email) requires smtp_addr, from and to", i+1)
+			}
+		default:
+			return errors.Errorf("sink #%d has unknown type %q", i+1, sink.Type)
+		}
+	}
+	return nil
+}
+
+type statusTransition struct {
+	Time         time.Time   `json:"time"`
+	CategoryName string      `json:"category_name"`
+	Name         string      `json:"name"`
+	From         *statusText `json:"from"`
+	To           *statusText `json:"to"`
+	Message      string      `json:"message"`
+}
+
+func (t *statusTransition) Subject() string {
+	return fmt.Sprintf("[%s] %s is %s", t.CategoryName, t.Name, t.To)
+}
+
+func (t *statusTransition) Text() string {
+	return fmt.Sprintf("[%s] %s: %s -> %s at %s\n%s",
+		t.CategoryName, t.Name, t.From, t.To, t.Time.Format("2006-01-02 15:04:05 MST"), strings.TrimSpace(t.Message))
+}
+
+type notifyState struct {
+	// the status last notified, or the first status observed
+	notified   *statusText
+	candidate  *statusText
+	count      int
+	lastSentAt time.Time
+}
+
+type notifyJob struct {
+	sink       *NotificationSink
+	transition *statusTransition
+	attempts   int
+}
+
+// notifier detects status transitions of services and sends them to the sinks with retries
+type notifier struct {
+	mu     sync.Mutex
+	conf   *Notification
+	states map[string]*notifyState
+	queue  chan *notifyJob
+	client *http.Client
+}
+
+func newNotifier(conf *Notification) *notifier {
+	if conf == nil {
+		conf = emptyNotification()
+	}
+	return &notifier{
+		conf:   conf,
+		states: map[string]*notifyState{},
+		queue:  make(chan *notifyJob, 100),
+		client: &http.Client{},
+	}
+}
+
+func emptyNotification() *Notification {
+	conf := &Notification{}
+	conf.prepare()
+	return conf
+}
+
+// setConf replaces the configuration. the states of services are kept
+func (n *notifier) setConf(conf *Notification) {
+	if conf == nil {
+		conf = emptyNotification()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conf = conf
+}
+
+func (n *notifier) config() *Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.conf
+}
+
+// observe records a check result and queues notifications when the status has changed
+func (n *notifier) observe(service *Service, status *statusText, message string, t time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := serviceKey(service)
+	st, ok := n.states[key]
+	if !ok {
+		// 起動直後の状態は通知せずに覚えておく
+		n.states[key] = &notifyState{notified: status}
+		return
+	}
+	if status == st.notified {
+		st.candidate = nil
+		st.count = 0
+		return
+	}
+	if status == st.candidate {
+		st.count++
+	} else {
+		st.candidate = status
+		st.count = 1
+	}
+	if st.count < n.conf.Consecutive {
+		return
+	}
+	if !st.lastSentAt.IsZero() && t.Sub(st.lastSentAt) < n.conf.MinInterval.Duration {
+		// フラッピング中は間隔をあけ、次の結果で改めて判定する
+		return
+	}
+	transition := &statusTransition{
+		Time:         t,
+		CategoryName: service.categoryName,
+		Name:         service.Name,
+		From:         st.notified,
+		To:           status,
+		Message:      message,
+	}
+	st.notified = status
+	st.candidate = nil
+	st.count = 0
+	st.lastSentAt = t
+	for _, sink := range n.conf.Sinks {
+		n.enqueue(&notifyJob{sink: sink, transition: transition})
+	}
+}
+
+func (n *notifier) enqueue(job *notifyJob) {
+	select {
+	case n.queue <- job:
+	default:
+		slog.Warn("notification queue is full. dropped", slog.String("sink", job.sink.Type), slog.String("service", job.transition.Name))
+	}
+}
+
+func (n *notifier) run(ctx context.Context) error {
+	for {
+		select {
+		case job := <-n.queue:
+			err := n.send(ctx, job.sink, job.transition)
+			if err == nil {
+				continue
+			}
+			job.attempts++
+			conf := n.config()
+			if job.attempts > conf.MaxRetries {
+				slog.Warn("failed to send notification. gave up", slog.String("sink", job.sink.Type), slog.String("service", job.transition.Name), slog.Any("error", err))
+				continue
+			}
+			slog.Warn("failed to send notification. will retry", slog.String("sink", job.sink.Type), slog.String("service", job.transition.Name), slog.Int("attempts", job.attempts), slog.Any("error", err))
+			time.AfterFunc(conf.RetryInterval.Duration, func() {
+				n.enqueue(job)
+			})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (n *notifier) send(ctx context.Context, sink *NotificationSink, t *statusTransition) error {
+	ctx, cancel := context.WithTimeout(ctx, sink.Timeout.Duration)
+	defer cancel()
+	switch sink.Type {
+	case "webhook":
+		return n.postJSON(ctx, sink, t)
+	case "slack":
+		return n.postJSON(ctx, sink, map[string]string{"text": t.Text()})
+	case "email":
+		return sendMail(ctx, sink, t)
+	}
+	return errors.Errorf("unknown sink type %q", sink.Type)
+}
+
+func (n *notifier) postJSON(ctx context.Context, sink *NotificationSink, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range sink.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+func sendMail(ctx context.Context, sink *NotificationSink, t *statusTransition) error {
+	host, _, err := net.SplitHostPort(sink.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", sink.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(sink.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[statusboard] "+t.Subject()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", t.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(t.Text(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", sink.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// 応答しないサーバで止まらないよう、タイムアウトやキャンセルで読み書きを中断する
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// smtp.SendMail と同じ手順で送る
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if sink.SMTPUsername != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", sink.SMTPUsername, sink.SMTPPassword, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(sink.From); err != nil {
+		return err
+	}
+	for _, to := range sink.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
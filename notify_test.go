@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookRecorder struct {
+	mu       sync.Mutex
+	payloads []map[string]any
+	fail     int
+}
+
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	payload := map[string]any{}
+	json.NewDecoder(req.Body).Decode(&payload)
+	r.payloads = append(r.payloads, payload)
+}
+
+func (r *webhookRecorder) received() []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]any{}, r.payloads...)
+}
+
+// startFakeSMTPServer accepts mails without extensions and sends the DATA of each mail to the channel
+func startFakeSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	mails := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+				reply("220 localhost ESMTP fake")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.TrimSpace(line))
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 localhost")
+					case strings.HasPrefix(cmd, "DATA"):
+						reply("354 end with .")
+						var data strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if l == ".\r\n" {
+								break
+							}
+							data.WriteString(l)
+						}
+						mails <- data.String()
+						reply("250 OK")
+					case strings.HasPrefix(cmd, "QUIT"):
+						reply("221 bye")
+						return
+					default:
+						reply("250 OK")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestNotifier_Observe(t *testing.T) {
+	conf := &Notification{Consecutive: 2, MinInterval: MustDuration("10m"), Sinks: []*NotificationSink{{Type: "webhook"}}}
+	if err := conf.prepare(); err == nil {
+		t.Fatal("expected error for sink without url")
+	}
+	conf.Sinks[0].URL = "http://127.0.0.1:1/"
+	if err := conf.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	n := newNotifier(conf)
+	service := &Service{Name: "API", categoryName: "Web"}
+	now := time.Now()
+
+	queued := func() []*statusTransition {
+		transitions := []*statusTransition{}
+		for {
+			select {
+			case job := <-n.queue:
+				transitions = append(transitions, job.transition)
+			default:
+				return transitions
+			}
+		}
+	}
+
+	n.observe(service, Operational, "", now)
+	n.observe(service, Outage, "", now.Add(1*time.Minute))
+	if got := queued(); len(got) != 0 {
+		t.Fatalf("notified after 1 failure: %+v", got)
+	}
+	n.observe(service, Outage, "down", now.Add(2*time.Minute))
+	got := queued()
+	if len(got) != 1 || got[0].From != Operational || got[0].To != Outage || got[0].Message != "down" {
+		t.Fatalf("transitions = %+v, want Operational -> Outage", got)
+	}
+
+	// recovered within min_interval: suppressed
+	n.observe(service, Operational, "", now.Add(3*time.Minute))
+	n.observe(service, Operational, "", now.Add(4*time.Minute))
+	if got := queued(); len(got) != 0 {
+		t.Fatalf("notified within min_interval: %+v", got)
+	}
+	n.observe(service, Operational, "", now.Add(13*time.Minute))
+	got = queued()
+	if len(got) != 1 || got[0].From != Outage || got[0].To != Operational {
+		t.Fatalf("transitions = %+v, want Outage -> Operational", got)
+	}
+}
+
+func TestNotifier_Sinks(t *testing.T) {
+	webhook := &webhookRecorder{fail: 1}
+	webhookServer := httptest.NewServer(webhook)
+	defer webhookServer.Close()
+	slack := &webhookRecorder{}
+	slackServer := httptest.NewServer(slack)
+	defer slackServer.Close()
+	smtpAddr, mails := startFakeSMTPServer(t)
+
+	conf := &Notification{
+		RetryInterval: MustDuration("10ms"),
+		Sinks: []*NotificationSink{
+			{Type: "webhook", URL: webhookServer.URL, Headers: map[string]string{"X-Token": "t"}},
+			{Type: "slack", URL: slackServer.URL},
+			{Type: "email", SMTPAddr: smtpAddr, From: "statusboard@example.com", To: []string{"ops@example.com"}},
+		},
+	}
+	if err := conf.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	n := newNotifier(conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.run(ctx)
+
+	service := &Service{Name: "API", categoryName: "Web"}
+	n.observe(service, Operational, "", time.Now())
+	n.observe(service, Degraded, "HTTP 200 OK in 3s", time.Now())
+
+	select {
+	case mail := <-mails:
+		if !strings.Contains(mail, "Subject: [statusboard] [Web] API is Degraded") || !strings.Contains(mail, "HTTP 200 OK in 3s") {
+			t.Errorf("mail = %q", mail)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mail was not sent")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(webhook.received()) == 0 || len(slack.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("webhooks were not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the first attempt failed and was retried
+	payload := webhook.received()[0]
+	if payload["from"] != "Operational" || payload["to"] != "Degraded" || payload["name"] != "API" {
+		t.Errorf("webhook payload = %+v", payload)
+	}
+	text, _ := slack.received()[0]["text"].(string)
+	if !strings.Contains(text, "[Web] API: Operational -> Degraded") {
+		t.Errorf("slack text = %q", text)
+	}
+}
+
+func TestSendMail_Timeout(t *testing.T) {
+	// 接続を受け付けるが応答しないサーバ
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1))
+		close(closed)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sink := &NotificationSink{Type: "email", SMTPAddr: ln.Addr().String(), From: "statusboard@example.com", To: []string{"ops@example.com"}}
+	transition := &statusTransition{Time: time.Now(), CategoryName: "Web", Name: "API", From: Operational, To: Outage}
+	if err := sendMail(ctx, sink, transition); err == nil {
+		t.Fatalf("sendMail should fail on timeout")
+	}
+	// タイムアウトした接続は閉じられている
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Errorf("connection should be closed after the timeout")
+	}
+}
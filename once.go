@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/gammazero/workerpool"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// maxOnceOutput is the max length of the output shown in the table of --once
+const maxOnceOutput = 80
+
+// onceResult is a result of a check run by --once
+type onceResult struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	checkResult
+}
+
+// selectServices returns the services to check. filter is "category/name" or the id of a service
+func (c *Config) selectServices(filter string) ([]*Service, error) {
+	services := []*Service{}
+	for _, category := range c.Categories {
+		for _, service := range category.Services {
+			if filter == "" || (service.ID != "" && service.ID == filter) || category.Name+"/"+service.Name == filter {
+				services = append(services, service)
+			}
+		}
+	}
+	if len(services) == 0 {
+		return nil, errors.Errorf("service %q is not found", filter)
+	}
+	return services, nil
+}
+
+// runOnce runs the checks of the services once and returns the results in the order of the configuration.
+// the results are written to the logs unless dryRun
+func (o *Opt) runOnce(ctx context.Context, services []*Service, dryRun bool) ([]*onceResult, error) {
+	logs := make([]*ServiceLog, len(services))
+	pool := workerpool.New(o.config.NumOfWorker)
+	for i, service := range services {
+		pool.Submit(func() {
+			logs[i] = o.runCheck(ctx, service)
+		})
+	}
+	pool.StopWait()
+
+	windows := o.maintenanceWindows()
+	results := make([]*onceResult, len(services))
+	for i, service := range services {
+		log := logs[i]
+		if !dryRun {
+			if err := o.appendServiceLog(log); err != nil {
+				return nil, err
+			}
+		}
+		serviceWindows := []*Maintenance{}
+		for _, m := range windows {
+			if m.affects(service) {
+				serviceWindows = append(serviceWindows, m)
+			}
+		}
+		results[i] = &onceResult{
+			Category: service.categoryName,
+			Name:     service.Name,
+			checkResult: checkResult{
+				Time:     log.Time,
+				ExitCode: log.Status,
+				Status:   service.statusIn(log.Status, log.Time, serviceWindows),
+				Duration: log.Duration,
+				Output:   log.Message,
+			},
+		}
+	}
+	return results, nil
+}
+
+// shortOutput makes the output fit in a row of the table
+func shortOutput(output string) string {
+	output = strings.Join(strings.Fields(output), " ")
+	if utf8.RuneCountInString(output) > maxOnceOutput {
+		output = string([]rune(output)[:maxOnceOutput-3]) + "..."
+	}
+	return output
+}
+
+func writeOnceResults(w io.Writer, format string, results []*onceResult) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CATEGORY\tSERVICE\tEXIT\tDURATION\tSTATUS\tOUTPUT")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", r.Category, r.Name, r.ExitCode, r.DurationText(), r.Status, shortOutput(r.Output))
+	}
+	return tw.Flush()
+}
+
+// checkOnce runs the checks once for --once and prints the results. returns the exit code
+func (o *Opt) checkOnce(ctx context.Context) int {
+	services, err := o.config.selectServices(o.Service)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if !o.DryRun {
+		o.store, err = newLogStore(o.Storage, o.Data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer o.store.Close()
+		if err := o.createServiceLog(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	// 管理APIで登録したメンテナンス期間も反映する
+	o.maintenances, err = loadMaintenanceStore(o.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	results, err := o.runOnce(ctx, services, o.DryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := writeOnceResults(os.Stdout, o.Format, results); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	for _, r := range results {
+		if r.Status.IsOutage() {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newOnceTestOpt(t *testing.T) *Opt {
+	t.Helper()
+	conf, err := loadToml(writeTempToml(t, `
+max_check_attempts = 1
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API / v2"
+  command = ["sh", "-c", "echo fine; echo done"]
+  [[category.service]]
+  id = "batch"
+  name = "Batch"
+  command = ["sh", "-c", "echo broken; exit 2"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Opt{Data: t.TempDir(), config: conf}
+}
+
+func TestSelectServices(t *testing.T) {
+	opt := newOnceTestOpt(t)
+	for filter, want := range map[string]int{"": 2, "Web/API / v2": 1, "batch": 1} {
+		services, err := opt.config.selectServices(filter)
+		if err != nil || len(services) != want {
+			t.Errorf("selectServices(%q) = %d services, %v, want %d", filter, len(services), err, want)
+		}
+	}
+	if _, err := opt.config.selectServices("Web/Unknown"); err == nil {
+		t.Errorf("selectServices should fail for unknown service")
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	opt := newOnceTestOpt(t)
+	services, _ := opt.config.selectServices("")
+	results, err := opt.runOnce(context.Background(), services, true)
+	if err != nil {
+		t.Fatalf("runOnce failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Status != Operational || results[1].Status != Outage ||
+		results[1].ExitCode != 2 || results[1].Output != "broken\n" {
+		t.Errorf("results = %+v %+v", results[0], results[1])
+	}
+	// dry-runでは書き込まない
+	if logs, _ := opt.logStore().readDay(time.Now().Format("20060102")); len(logs) != 0 {
+		t.Errorf("logs should not be written in dry-run: %+v", logs)
+	}
+
+	if _, err := opt.runOnce(context.Background(), services[1:], false); err != nil {
+		t.Fatalf("runOnce failed: %v", err)
+	}
+	logs, err := opt.logStore().readDay(time.Now().Format("20060102"))
+	if err != nil || len(logs) != 1 || logs[0].ServiceID != "batch" || logs[0].Status != 2 {
+		t.Errorf("logs = %+v, %v", logs, err)
+	}
+
+	// メンテナンス中はOutageにしない
+	opt.config.Maintenance = []*Maintenance{{Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}}
+	results, _ = opt.runOnce(context.Background(), services[1:], true)
+	if results[0].Status != MaintenanceStatus {
+		t.Errorf("Status = %v, want Maintenance", results[0].Status)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOnceResults(&buf, "text", results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "CATEGORY") || !strings.Contains(lines[1], "Maintenance") || !strings.HasSuffix(lines[1], "broken") {
+		t.Errorf("table = %q", buf.String())
+	}
+	buf.Reset()
+	if err := writeOnceResults(&buf, "json", results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"name": "Batch"`) || !strings.Contains(buf.String(), `"exit_code": 2`) {
+		t.Errorf("json = %s", buf.String())
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// watchInterval is the interval to poll the toml file with --watch
+var watchInterval = 2 * time.Second
+
+type ReloadStatus struct {
+	Time  time.Time `json:"time"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// reloadConfig loads the toml file again and replaces the configuration.
+// when the file is invalid, the current configuration is kept
+func (o *Opt) reloadConfig(ctx context.Context) error {
+	conf, err := loadToml(o.Toml)
+	status := &ReloadStatus{Time: time.Now(), OK: err == nil}
+	if err != nil {
+		slog.Error("failed to reload configuration. keep the current one", slog.String("toml", o.Toml), slog.Any("error", err))
+		status.Error = err.Error()
+		o.rwlock.Lock()
+		o.config.LastReload = status
+		o.rwlock.Unlock()
+		o.renderStatusPage(ctx)
+		return err
+	}
+	conf.LastReload = status
+
+	o.rwlock.Lock()
+	old := o.config
+	o.config = conf
+	o.rwlock.Unlock()
+
+	if conf.NumOfWorker != old.NumOfWorker {
+		slog.Warn("num_of_worker is not changed until restart", slog.Int("num_of_worker", old.NumOfWorker), slog.Int("new_num_of_worker", conf.NumOfWorker))
+	}
+	if conf.Timezone != old.Timezone {
+		slog.Warn("timezone is not changed until restart", slog.String("timezone", old.Timezone), slog.String("new_timezone", conf.Timezone))
+	}
+	o.metrics.forgetServices(old, conf)
+	if o.notifier != nil {
+		o.notifier.setConf(conf.Notification)
+	}
+	// 実行中のチェックはそのまま終わらせ、新しい設定でスケジュールし直す
+	select {
+	case o.reloaded <- struct{}{}:
+	default:
+	}
+	slog.Info("configuration reloaded", slog.String("toml", o.Toml))
+	return o.renderStatusPage(ctx)
+}
+
+// watchReload reloads the configuration on SIGHUP, and on changes of the toml file if --watch is given
+func (o *Opt) watchReload(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	var lastMod time.Time
+	var lastSize int64
+	if o.Watch {
+		t := time.NewTicker(watchInterval)
+		defer t.Stop()
+		poll = t.C
+		if fi, err := os.Stat(o.Toml); err == nil {
+			lastMod, lastSize = fi.ModTime(), fi.Size()
+		}
+	}
+	for {
+		select {
+		case <-hup:
+			slog.Info("received SIGHUP")
+			o.reloadConfig(ctx)
+		case <-poll:
+			fi, err := os.Stat(o.Toml)
+			if err != nil {
+				// エディタによる置き換えの途中かもしれないので次回に再確認する
+				continue
+			}
+			if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+				continue
+			}
+			lastMod, lastSize = fi.ModTime(), fi.Size()
+			slog.Info("toml file changed", slog.String("toml", o.Toml))
+			o.reloadConfig(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
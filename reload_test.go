@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const reloadTomlBefore = `
+worker_interval = "50ms"
+
+[[category]]
+name = "Web"
+
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`
+
+const reloadTomlAfter = `
+worker_interval = "50ms"
+
+[[category]]
+name = "Web"
+
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+
+  [[category.service]]
+  name = "Batch"
+  command = ["sh", "-c", "true"]
+`
+
+func TestReloadConfig(t *testing.T) {
+	path := writeTempToml(t, reloadTomlBefore)
+	conf, err := loadToml(path)
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	opt := &Opt{Toml: path, Data: t.TempDir(), config: conf}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(reloadTomlAfter), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.reloadConfig(context.Background()); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if got := len(opt.config.Categories[0].Services); got != 2 {
+		t.Errorf("services = %d, want 2", got)
+	}
+	if opt.config.LastReload == nil || !opt.config.LastReload.OK {
+		t.Errorf("LastReload = %+v, want ok", opt.config.LastReload)
+	}
+
+	// 不正な設定は反映せずに、結果だけを記録する
+	if err := os.WriteFile(path, []byte("[[category]]\nname = \"Web\"\n[[category.service]]\nname = \"API\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.reloadConfig(context.Background()); err == nil {
+		t.Fatal("reloadConfig should fail with invalid configuration")
+	}
+	if got := len(opt.config.Categories[0].Services); got != 2 {
+		t.Errorf("services = %d, want 2 (old configuration)", got)
+	}
+	if opt.config.LastReload == nil || opt.config.LastReload.OK || !strings.Contains(opt.config.LastReload.Error, "has no command") {
+		t.Errorf("LastReload = %+v, want error", opt.config.LastReload)
+	}
+}
+
+func TestStartWorker_Reload(t *testing.T) {
+	path := writeTempToml(t, reloadTomlBefore)
+	conf, err := loadToml(path)
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	opt := &Opt{Toml: path, Data: t.TempDir(), config: conf, reloaded: make(chan struct{}, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- opt.startWorker(ctx)
+	}()
+	time.Sleep(150 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(reloadTomlAfter), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.reloadConfig(ctx); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("startWorker failed: %v", err)
+	}
+
+	opt.rwlock.RLock()
+	services := opt.config.Categories[0].Services
+	opt.rwlock.RUnlock()
+	if count := countOfDay(opt, services[0], time.Now()); count.operational < 4 {
+		t.Errorf("API checked %d times, want >= 4", count.operational)
+	}
+	if count := countOfDay(opt, services[1], time.Now()); count.operational < 2 {
+		t.Errorf("Batch checked %d times after reload, want >= 2", count.operational)
+	}
+}
+
+func TestWatchReload(t *testing.T) {
+	path := writeTempToml(t, reloadTomlBefore)
+	conf, err := loadToml(path)
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	opt := &Opt{Toml: path, Data: t.TempDir(), Watch: true, config: conf}
+	defer func(d time.Duration) { watchInterval = d }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go opt.watchReload(ctx)
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(reloadTomlAfter), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		opt.rwlock.RLock()
+		n := len(opt.config.Categories[0].Services)
+		opt.rwlock.RUnlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("configuration was not reloaded after the file changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Retention struct {
+	// days to keep the raw logs. 0 keeps them forever
+	RawDays int `toml:"raw_days"`
+	// days to keep the daily summaries of the removed raw logs. 0 keeps them forever
+	SummaryDays int `toml:"summary_days"`
+	// days after which the raw logs are compressed. 0 disables compression
+	CompressAfterDays int      `toml:"compress_after_days"`
+	Interval          duration `toml:"interval"`
+}
+
+func (r *Retention) prepare() error {
+	if r.RawDays < 0 || r.SummaryDays < 0 || r.CompressAfterDays < 0 {
+		return errors.New("days must not be negative")
+	}
+	if r.SummaryDays > 0 && r.SummaryDays <= r.RawDays {
+		return errors.New("summary_days must be longer than raw_days")
+	}
+	if r.SummaryDays > 0 && r.RawDays == 0 {
+		return errors.New("summary_days requires raw_days")
+	}
+	if r.Interval.IsZero() {
+		r.Interval = MustDuration("1h")
+	}
+	return nil
+}
+
+// olderThan reports whether the day (YYYYMMDD) is before the last n days including today
+func olderThan(day string, now time.Time, n int) bool {
+	return day < dayOf(now.AddDate(0, 0, -(n-1)))
+}
+
+// cleanupLogs applies the retention policy to the storage
+func (o *Opt) cleanupLogs(now time.Time) error {
+	o.rwlock.RLock()
+	r := o.config.Retention
+	o.rwlock.RUnlock()
+	if r == nil {
+		return nil
+	}
+	store := o.logStore()
+	logDays, summaryDays, err := store.days()
+	if err != nil {
+		return errors.Wrap(err, "failed to list logs")
+	}
+	for _, day := range logDays {
+		switch {
+		case r.RawDays > 0 && olderThan(day, now, r.RawDays):
+			keepSummary := r.SummaryDays == 0 || !olderThan(day, now, r.SummaryDays)
+			err := o.index.maintain(func() error {
+				if !keepSummary {
+					o.index.forget(day)
+					return store.deleteLogs(day)
+				}
+				logs, err := store.readDay(day)
+				if err != nil {
+					return err
+				}
+				// 履歴の表示に必要な集計だけを残す。集計は変わらないのでインデックスはそのまま使える
+				if len(logs) > 0 {
+					if err := store.writeSummary(day, summarizeLogs(logs, now)); err != nil {
+						return err
+					}
+				}
+				return store.deleteLogs(day)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to remove logs of %s", day)
+			}
+			slog.Info("removed logs", slog.String("day", day), slog.Bool("summary", keepSummary))
+		case r.CompressAfterDays > 0 && olderThan(day, now, r.CompressAfterDays):
+			if err := o.index.maintain(func() error { return store.compress(day) }); err != nil {
+				return errors.Wrapf(err, "failed to compress logs of %s", day)
+			}
+		}
+	}
+	for _, day := range summaryDays {
+		if r.SummaryDays > 0 && olderThan(day, now, r.SummaryDays) {
+			err := o.index.maintain(func() error {
+				o.index.forget(day)
+				return store.deleteSummary(day)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to remove summary of %s", day)
+			}
+			slog.Info("removed summary", slog.String("day", day))
+		}
+	}
+	return nil
+}
+
+// runJanitor applies the retention policy periodically
+func (o *Opt) runJanitor(ctx context.Context) error {
+	for {
+		if err := o.cleanupLogs(time.Now()); err != nil {
+			slog.Warn("failed to clean up logs", slog.Any("error", err))
+		}
+		// 設定の再読み込みで変わることがあるので毎回読む
+		interval := time.Hour
+		o.rwlock.RLock()
+		if r := o.config.Retention; r != nil {
+			interval = r.Interval.Duration
+		}
+		o.rwlock.RUnlock()
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
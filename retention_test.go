@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadToml_Retention(t *testing.T) {
+	base := `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`
+	conf, err := loadToml(writeTempToml(t, base+"[retention]\nraw_days = 7\nsummary_days = 90\n"))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	if conf.Retention.Interval.Duration != time.Hour {
+		t.Errorf("Interval = %v, want 1h", conf.Retention.Interval)
+	}
+
+	for _, retention := range []string{
+		"raw_days = -1",
+		"raw_days = 30\nsummary_days = 7",
+		"summary_days = 30",
+	} {
+		_, err := loadToml(writeTempToml(t, base+"[retention]\n"+retention+"\n"))
+		if err == nil || !strings.Contains(err.Error(), "retention") {
+			t.Errorf("loadToml should fail with %q: %v", retention, err)
+		}
+	}
+}
+
+func TestCleanupLogs(t *testing.T) {
+	for _, storage := range []string{"file", "sqlite"} {
+		t.Run(storage, func(t *testing.T) {
+			opt := newTestOpt(t)
+			store, err := newLogStore(storage, opt.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if err := store.init(); err != nil {
+				t.Fatal(err)
+			}
+			opt.store = store
+			opt.config.HistoryDays = 60
+			opt.config.Retention = &Retention{RawDays: 7, SummaryDays: 30, CompressAfterDays: 2}
+
+			now := time.Now()
+			svc := opt.config.Categories[0].Services[0]
+			for _, ago := range []int{40, 10, 3, 0} {
+				d := now.AddDate(0, 0, -ago)
+				if err := store.append(&ServiceLog{Time: d, Name: "Google", CategoryName: "Web", Command: svc.Command, Status: 2}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := opt.cleanupLogs(now); err != nil {
+				t.Fatalf("cleanupLogs failed: %v", err)
+			}
+
+			logDays, summaryDays, err := store.days()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logDays) != 2 || len(summaryDays) != 1 || summaryDays[0] != now.AddDate(0, 0, -10).Format("20060102") {
+				t.Errorf("days = %v, %v, want 2 days of logs and the summary of 10 days ago", logDays, summaryDays)
+			}
+			if storage == "file" {
+				old := logFilePath(opt.Data, now.AddDate(0, 0, -3).Format("20060102"))
+				if _, err := os.Stat(old + ".gz"); err != nil {
+					t.Errorf("log file should be compressed: %v", err)
+				}
+				if _, err := os.Stat(old); !os.IsNotExist(err) {
+					t.Errorf("log file should be removed after compression: %v", err)
+				}
+			}
+			// 圧縮したログもそのまま読める
+			if count := countOfDay(opt, svc, now.AddDate(0, 0, -3)); count.total() != 1 {
+				t.Errorf("count = %+v, want 1 log", count)
+			}
+
+			if err := opt.renderStatusPage(context.Background()); err != nil {
+				t.Fatalf("renderStatusPage failed: %v", err)
+			}
+			for _, tt := range []struct {
+				ago  int
+				want *statusText
+			}{{0, Outage}, {3, Outage}, {10, Outage}, {40, NoDATA}} {
+				if got := svc.StatusHistory[tt.ago]; got != tt.want {
+					t.Errorf("StatusHistory[%d] = %v, want %v", tt.ago, got, tt.want)
+				}
+			}
+			if got := svc.Uptime.Days30.String(); got != "0.00%" {
+				t.Errorf("Uptime.Days30 = %s, want 0.00%%", got)
+			}
+		})
+	}
+}
+
+func TestFileStore_AppendAfterCompression(t *testing.T) {
+	dir := t.TempDir()
+	store := &fileStore{dir: dir}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	day := yesterday.Format("20060102")
+	for i := 0; i < 2; i++ {
+		if err := store.append(&ServiceLog{Time: yesterday, Name: "API", CategoryName: "Web", Status: i}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.compress(day); err != nil {
+			t.Fatalf("compress failed: %v", err)
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "log*"))
+	if len(matches) != 1 {
+		t.Errorf("files = %v, want only the compressed file", matches)
+	}
+	logs, err := store.readDay(day)
+	if err != nil || len(logs) != 2 || logs[1].Status != 1 {
+		t.Errorf("readDay = %+v, %v, want 2 logs", logs, err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteFileName = "statusboard.db"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS service_logs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	day TEXT NOT NULL,
+	time INTEGER NOT NULL,
+	category_id TEXT NOT NULL DEFAULT '',
+	category_name TEXT NOT NULL,
+	service_id TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	duration REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS service_logs_day ON service_logs (day);
+CREATE INDEX IF NOT EXISTS service_logs_service_time ON service_logs (category_name, name, time);
+CREATE TABLE IF NOT EXISTS daily_summaries (
+	day TEXT PRIMARY KEY,
+	summary TEXT NOT NULL
+);
+`
+
+// columns added after the first version of the schema
+var sqliteMigrations = []struct {
+	column string
+	ddl    string
+}{
+	{"category_id", `ALTER TABLE service_logs ADD COLUMN category_id TEXT NOT NULL DEFAULT ''`},
+	{"service_id", `ALTER TABLE service_logs ADD COLUMN service_id TEXT NOT NULL DEFAULT ''`},
+}
+
+const sqliteIndexes = `
+CREATE INDEX IF NOT EXISTS service_logs_service_id_time ON service_logs (service_id, time);
+`
+
+// sqliteStore writes the logs to a SQLite database in the data dir
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+	// 書き込みは1つずつしかできないので、接続を共有する
+	db.SetMaxOpenConns(1)
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) init() error {
+	if _, err := s.db.Exec(sqliteSchema); err != nil {
+		return errors.Wrap(err, "failed to create tables")
+	}
+	for _, m := range sqliteMigrations {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('service_logs') WHERE name = ?`, m.column).Scan(&n); err != nil {
+			return errors.Wrap(err, "failed to read the schema")
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := s.db.Exec(m.ddl); err != nil {
+			return errors.Wrapf(err, "failed to add %s", m.column)
+		}
+	}
+	if _, err := s.db.Exec(sqliteIndexes); err != nil {
+		return errors.Wrap(err, "failed to create indexes")
+	}
+	return nil
+}
+
+// sqlExecer is *sql.DB or *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (s *sqliteStore) append(log *ServiceLog) error {
+	return insertLog(s.db, dayOf(log.Time), log)
+}
+
+func insertLog(db sqlExecer, day string, log *ServiceLog) error {
+	command, err := json.Marshal(log.Command)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO service_logs (day, time, category_id, category_name, service_id, name, command, status, message, duration) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		day, log.Time.UnixNano(), log.CategoryID, log.CategoryName, log.ServiceID, log.Name, string(command), log.Status, log.Message, log.Duration)
+	return err
+}
+
+const sqliteColumns = `time, category_id, category_name, service_id, name, command, status, message, duration`
+
+func (s *sqliteStore) readDay(day string) ([]*ServiceLog, error) {
+	return s.selectLogs(`SELECT `+sqliteColumns+` FROM service_logs WHERE day = ? ORDER BY id`, day)
+}
+
+func (s *sqliteStore) query(serviceID, categoryName, name string, from, to time.Time) ([]*ServiceLog, error) {
+	return s.selectLogs(`SELECT `+sqliteColumns+` FROM service_logs WHERE ((service_id != '' AND service_id = ?) OR (service_id = '' AND category_name = ? AND name = ?)) AND time >= ? AND time < ? ORDER BY id`,
+		serviceID, categoryName, name, from.UnixNano(), to.UnixNano())
+}
+
+func (s *sqliteStore) replaceDay(day string, logs []*ServiceLog) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM service_logs WHERE day = ?`, day); err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if err := insertLog(tx, day, log); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) selectLogs(query string, args ...any) ([]*ServiceLog, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	logs := []*ServiceLog{}
+	for rows.Next() {
+		log := &ServiceLog{}
+		var t int64
+		var command string
+		if err := rows.Scan(&t, &log.CategoryID, &log.CategoryName, &log.ServiceID, &log.Name, &command, &log.Status, &log.Message, &log.Duration); err != nil {
+			return nil, err
+		}
+		log.Time = time.Unix(0, t)
+		if err := json.Unmarshal([]byte(command), &log.Command); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	return logs, rows.Err()
+}
+
+func (s *sqliteStore) days() ([]string, []string, error) {
+	logs, err := s.selectDays(`SELECT DISTINCT day FROM service_logs ORDER BY day`)
+	if err != nil {
+		return nil, nil, err
+	}
+	summaries, err := s.selectDays(`SELECT day FROM daily_summaries ORDER BY day`)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logs, summaries, nil
+}
+
+func (s *sqliteStore) selectDays(query string) ([]string, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	days := []string{}
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+func (s *sqliteStore) readSummary(day string) (*daySummary, error) {
+	var b string
+	err := s.db.QueryRow(`SELECT summary FROM daily_summaries WHERE day = ?`, day).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	summary := &daySummary{}
+	if err := json.Unmarshal([]byte(b), summary); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode summary of %s", day)
+	}
+	return summary, nil
+}
+
+func (s *sqliteStore) writeSummary(day string, summary *daySummary) error {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO daily_summaries (day, summary) VALUES (?, ?)`, day, string(b))
+	return err
+}
+
+func (s *sqliteStore) deleteLogs(day string) error {
+	_, err := s.db.Exec(`DELETE FROM service_logs WHERE day = ?`, day)
+	return err
+}
+
+func (s *sqliteStore) deleteSummary(day string) error {
+	_, err := s.db.Exec(`DELETE FROM daily_summaries WHERE day = ?`, day)
+	return err
+}
+
+// compress does nothing. the space of deleted rows is reused by SQLite
+func (s *sqliteStore) compress(string) error {
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// days to calculate uptime percentages
+var uptimeRanges = []int{7, 30, 90}
+
+// latencyDays is the number of days to calculate the latency percentiles
+const latencyDays = 7
+
+// Uptime is the percentage of available checks. maintenance is not counted
+type Uptime struct {
+	Percent float64
+	HasData bool
+}
+
+func (c *statusCount) uptime() Uptime {
+	// Degradedは応答しているので稼働として数える
+	up := c.operational + c.degraded
+	total := up + c.outage
+	if total == 0 {
+		return Uptime{}
+	}
+	return Uptime{Percent: float64(up) * 100 / float64(total), HasData: true}
+}
+
+func (c *statusCount) merge(o *statusCount) {
+	c.operational += o.operational
+	c.degraded += o.degraded
+	c.outage += o.outage
+	c.maintenance += o.maintenance
+}
+
+func (u Uptime) MarshalJSON() ([]byte, error) {
+	if !u.HasData {
+		return []byte("null"), nil
+	}
+	return []byte(fmt.Sprintf("%.3f", math.Floor(u.Percent*1000)/1000)), nil
+}
+
+func (u Uptime) String() string {
+	if !u.HasData {
+		return "-"
+	}
+	// 切り上げて100%と表示されないように切り捨てる
+	return fmt.Sprintf("%.2f%%", math.Floor(u.Percent*100)/100)
+}
+
+type UptimeSummary struct {
+	Days7  Uptime `json:"7d"`
+	Days30 Uptime `json:"30d"`
+	Days90 Uptime `json:"90d"`
+}
+
+func newUptimeSummary(counts []*statusCount) UptimeSummary {
+	return UptimeSummary{
+		Days7:  counts[0].uptime(),
+		Days30: counts[1].uptime(),
+		Days90: counts[2].uptime(),
+	}
+}
+
+// Latency is the percentiles of check durations in milliseconds
+type Latency struct {
+	P50     float64
+	P95     float64
+	HasData bool
+}
+
+// percentile returns the p-th percentile of sorted values by the nearest-rank method
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// newLatency calculates the percentiles from durations in seconds
+func newLatency(durations []float64) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	return Latency{
+		P50:     math.Round(percentile(sorted, 50) * 1000),
+		P95:     math.Round(percentile(sorted, 95) * 1000),
+		HasData: true,
+	}
+}
+
+func (l Latency) MarshalJSON() ([]byte, error) {
+	if !l.HasData {
+		return []byte("null"), nil
+	}
+	return []byte(fmt.Sprintf(`{"p50_ms":%g,"p95_ms":%g}`, l.P50, l.P95)), nil
+}
+
+func (l Latency) String() string {
+	if !l.HasData {
+		return "-"
+	}
+	return fmt.Sprintf("p50 %s / p95 %s",
+		time.Duration(l.P50)*time.Millisecond, time.Duration(l.P95)*time.Millisecond)
+}
+
+type timelineDay struct {
+	Date   string
+	Status *statusText
+	Uptime Uptime
+}
+
+// newTimeline returns the history from the oldest day for the bar timeline
+func newTimeline(dates []string, history []*statusText, uptimes []Uptime) []*timelineDay {
+	timeline := make([]*timelineDay, len(dates))
+	for i := range dates {
+		timeline[len(dates)-1-i] = &timelineDay{Date: dates[i], Status: history[i], Uptime: uptimes[i]}
+	}
+	return timeline
+}
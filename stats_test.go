@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+func TestUptime(t *testing.T) {
+	tests := []struct {
+		count *statusCount
+		want  string
+	}{
+		{&statusCount{}, "-"},
+		{&statusCount{operational: 3, degraded: 1}, "100.00%"},
+		{&statusCount{operational: 3, outage: 1, maintenance: 10}, "75.00%"},
+		// 99.999%を100%と表示しない
+		{&statusCount{operational: 99999, outage: 1}, "99.99%"},
+	}
+	for _, tt := range tests {
+		if got := tt.count.uptime().String(); got != tt.want {
+			t.Errorf("uptime of %+v = %s, want %s", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestNewLatency(t *testing.T) {
+	if l := newLatency(nil); l.HasData {
+		t.Errorf("latency without durations should have no data")
+	}
+	durations := []float64{}
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, float64(i)/1000)
+	}
+	l := newLatency(durations)
+	if l.P50 != 50 || l.P95 != 95 {
+		t.Errorf("latency = %+v, want p50=50 p95=95", l)
+	}
+	if l.String() != "p50 50ms / p95 95ms" {
+		t.Errorf("String() = %q", l.String())
+	}
+}
+
+func TestLoadLog_Uptime(t *testing.T) {
+	opt := newTestOpt(t)
+	svc := opt.config.Categories[0].Services[0]
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	old := now.AddDate(0, 0, -20)
+	command := []string{"ping", "google.com"}
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: now.Add(-10 * time.Minute), Name: "Google", CategoryName: "Web", Command: command, Status: 0, Duration: 0.01},
+		{Time: now.Add(-5 * time.Minute), Name: "Google", CategoryName: "Web", Command: command, Status: 0, Duration: 0.03},
+	}, now.Format("20060102"))
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: yesterday, Name: "Google", CategoryName: "Web", Command: command, Status: 0},
+		{Time: yesterday, Name: "Google", CategoryName: "Web", Command: command, Status: 2},
+	}, yesterday.Format("20060102"))
+	writeServiceLog(t, opt.Data, []*ServiceLog{
+		{Time: old, Name: "Google", CategoryName: "Web", Command: command, Status: 2},
+		{Time: old, Name: "Google", CategoryName: "Web", Command: command, Status: 2},
+	}, old.Format("20060102"))
+
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	if got := svc.UptimeHistory[0].String(); got != "100.00%" {
+		t.Errorf("UptimeHistory[0] = %s, want 100.00%%", got)
+	}
+	if got := svc.UptimeHistory[1].String(); got != "50.00%" {
+		t.Errorf("UptimeHistory[1] = %s, want 50.00%%", got)
+	}
+	if svc.UptimeHistory[2].HasData {
+		t.Errorf("UptimeHistory[2] should have no data")
+	}
+	if got := svc.Uptime.Days7.String(); got != "75.00%" {
+		t.Errorf("Uptime.Days7 = %s, want 75.00%%", got)
+	}
+	if got := svc.Uptime.Days30.String(); got != "50.00%" {
+		t.Errorf("Uptime.Days30 = %s, want 50.00%%", got)
+	}
+	if got := opt.config.Categories[0].Uptime.Days30.String(); got != "50.00%" {
+		t.Errorf("Category.Uptime.Days30 = %s, want 50.00%%", got)
+	}
+	if svc.Latency.P50 != 10 || svc.Latency.P95 != 30 {
+		t.Errorf("Latency = %+v, want p50=10 p95=30", svc.Latency)
+	}
+	if !bytes.Contains(opt.htmlBlob, []byte("50.00% uptime (30d)")) {
+		t.Errorf("htmlBlob does not contain the uptime of the category")
+	}
+
+	b, err := json.Marshal(opt.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"uptime":{"7d":75.000,"30d":50.000,"90d":50.000}`, `"latency":{"p50_ms":10,"p95_ms":30}`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("json does not contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// logStore is the storage of the check results
+type logStore interface {
+	// init prepares the storage and checks it is writable
+	init() error
+	append(log *ServiceLog) error
+	// readDay returns all logs of the day (YYYYMMDD) in the order written
+	readDay(day string) ([]*ServiceLog, error)
+	// query returns the logs of the service written in [from, to) in the order written.
+	// logs with the service id are matched by the id, and the others by the category and name
+	query(serviceID, categoryName, name string, from, to time.Time) ([]*ServiceLog, error)
+	// replaceDay replaces all logs of the day
+	replaceDay(day string, logs []*ServiceLog) error
+	// days returns the days with the raw logs and the days with the summaries
+	days() (logs []string, summaries []string, err error)
+	// readSummary returns the summary of the day written by writeSummary. nil if the day has no summary
+	readSummary(day string) (*daySummary, error)
+	writeSummary(day string, summary *daySummary) error
+	deleteLogs(day string) error
+	deleteSummary(day string) error
+	// compress reduces the size of the raw logs of the day if the storage supports it
+	compress(day string) error
+	Close() error
+}
+
+func newLogStore(storage, dir string) (logStore, error) {
+	switch storage {
+	case "", "file":
+		return &fileStore{dir: dir}, nil
+	case "sqlite":
+		return openSQLiteStore(filepath.Join(dir, sqliteFileName))
+	}
+	return nil, fmt.Errorf("unknown storage: %s", storage)
+}
+
+// logStore returns the storage of the check results. the file storage is used if not opened
+func (o *Opt) logStore() logStore {
+	if o.store == nil {
+		return &fileStore{dir: o.Data}
+	}
+	return o.store
+}
+
+// fileStore writes the logs to daily JSON lines files named logYYYYMMDD.txt.
+// old files are compressed to logYYYYMMDD.txt.gz, and replaced with summaryYYYYMMDD.json after the retention
+type fileStore struct {
+	dir string
+}
+
+// dayOf returns the day (YYYYMMDD) of t in the local time zone, which is set by timezone in the configuration.
+// the logs are split and aggregated by this day
+func dayOf(t time.Time) string {
+	return t.Local().Format("20060102")
+}
+
+func logFilePath(dir string, day string) string {
+	return filepath.Join(dir, fmt.Sprintf("log%s.txt", day))
+}
+
+func summaryFilePath(dir string, day string) string {
+	return filepath.Join(dir, fmt.Sprintf("summary%s.json", day))
+}
+
+func (s *fileStore) init() error {
+	file, err := os.OpenFile(logFilePath(s.dir, dayOf(time.Now())), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (s *fileStore) append(log *ServiceLog) error {
+	file, err := os.OpenFile(logFilePath(s.dir, dayOf(log.Time)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(log)
+}
+
+func (s *fileStore) readDay(day string) ([]*ServiceLog, error) {
+	path := logFilePath(s.dir, day)
+	compressed, err := readLogFile(path + ".gz")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return compressed, err
+	}
+	// 圧縮した後に書き込まれたログがあれば続けて読む
+	logs, err := readLogFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && len(compressed) > 0 {
+			return compressed, nil
+		}
+		return logs, err
+	}
+	return append(compressed, logs...), nil
+}
+
+// matchesService reports whether the log is the result of the service in the way of logStore.query
+func (log *ServiceLog) matchesService(serviceID, categoryName, name string) bool {
+	if log.ServiceID != "" {
+		return log.ServiceID == serviceID
+	}
+	return log.CategoryName == categoryName && log.Name == name
+}
+
+func (s *fileStore) query(serviceID, categoryName, name string, from, to time.Time) ([]*ServiceLog, error) {
+	result := []*ServiceLog{}
+	// ファイルは日ごとなので、期間に含まれる日のうちログのある日のファイルだけを読む
+	days, _, err := s.days()
+	if err != nil {
+		return nil, err
+	}
+	first, last := dayOf(from), dayOf(to)
+	for _, day := range days {
+		if day < first || day > last {
+			continue
+		}
+		logs, err := s.readDay(day)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, log := range logs {
+			if log.matchesService(serviceID, categoryName, name) && !log.Time.Before(from) && log.Time.Before(to) {
+				result = append(result, log)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *fileStore) replaceDay(day string, logs []*ServiceLog) error {
+	path := logFilePath(s.dir, day)
+	compressed := true
+	if _, err := os.Stat(path + ".gz"); errors.Is(err, os.ErrNotExist) {
+		compressed = false
+	}
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var zw *gzip.Writer
+	if compressed {
+		zw = gzip.NewWriter(buf)
+		w = zw
+	}
+	enc := json.NewEncoder(w)
+	for _, log := range logs {
+		if err := enc.Encode(log); err != nil {
+			return err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		// 圧縮後に書き込まれたログも含めて1つのファイルにまとめる
+		if err := writeFileAtomic(path+".gz", buf.Bytes()); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// writeFileAtomic replaces the file with b atomically
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var logFileRegexp = regexp.MustCompile(`^log(\d{8})\.txt(\.gz)?$`)
+var summaryFileRegexp = regexp.MustCompile(`^summary(\d{8})\.json$`)
+
+func (s *fileStore) days() ([]string, []string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	logs := []string{}
+	summaries := []string{}
+	for _, e := range entries {
+		if m := logFileRegexp.FindStringSubmatch(e.Name()); m != nil {
+			// 圧縮前後のファイルが両方ある日は1つにまとめる
+			if !slices.Contains(logs, m[1]) {
+				logs = append(logs, m[1])
+			}
+		} else if m := summaryFileRegexp.FindStringSubmatch(e.Name()); m != nil {
+			summaries = append(summaries, m[1])
+		}
+	}
+	return logs, summaries, nil
+}
+
+func (s *fileStore) readSummary(day string) (*daySummary, error) {
+	b, err := os.ReadFile(summaryFilePath(s.dir, day))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	summary := &daySummary{}
+	if err := json.Unmarshal(b, summary); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode summary of %s", day)
+	}
+	return summary, nil
+}
+
+func (s *fileStore) writeSummary(day string, summary *daySummary) error {
+	return writeJSONFile(summaryFilePath(s.dir, day), summary)
+}
+
+func (s *fileStore) deleteLogs(day string) error {
+	path := logFilePath(s.dir, day)
+	for _, p := range []string{path, path + ".gz"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) deleteSummary(day string) error {
+	if err := os.Remove(summaryFilePath(s.dir, day)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) compress(day string) error {
+	path := logFilePath(s.dir, day)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// 圧縮済み
+			return nil
+		}
+		return err
+	}
+	// 圧縮済みのファイルがあればgzipのメンバーとして追記する
+	file, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(file)
+	if _, err := zw.Write(b); err != nil {
+		file.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+// readLogFile reads all logs in the file. files with the .gz suffix are decompressed
+func readLogFile(path string) ([]*ServiceLog, error) {
+	logs := make([]*ServiceLog, 0, 500)
+	file, err := os.Open(path)
+	if err != nil {
+		return logs, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return logs, errors.Wrapf(err, "failed to read %s", path)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	scanner := bufio.NewScanner(r)
+	// 各行を読み込み
+	for scanner.Scan() {
+		servicelog := &ServiceLog{}
+		// JSON をデコード
+		err := json.Unmarshal(scanner.Bytes(), servicelog)
+		if err != nil {
+			slog.Warn("Error decoding JSON", slog.Any("error", err))
+			continue
+		}
+		// 書き込んだ時のタイムゾーンではなく設定したタイムゾーンで扱う
+		servicelog.Time = servicelog.Time.Local()
+		logs = append(logs, servicelog)
+	}
+	// エラーチェック
+	if err := scanner.Err(); err != nil {
+		slog.Warn("Error reading file", slog.Any("error", err))
+	}
+	return logs, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogStore(t *testing.T) {
+	for _, storage := range []string{"file", "sqlite"} {
+		t.Run(storage, func(t *testing.T) {
+			store, err := newLogStore(storage, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if err := store.init(); err != nil {
+				t.Fatalf("init failed: %v", err)
+			}
+
+			now := time.Now()
+			yesterday := now.AddDate(0, 0, -1)
+			logs := []*ServiceLog{
+				{Time: yesterday, Name: "API", CategoryName: "Web", Command: []string{"true"}, Status: 2, Message: "down"},
+				{Time: now.Add(-2 * time.Minute), Name: "API", CategoryName: "Web", Command: []string{"true"}, Status: 0, Duration: 0.5},
+				{Time: now.Add(-time.Minute), Name: "DB", CategoryName: "Web", Command: []string{"false"}, Status: 1},
+				{Time: now, Name: "API", CategoryName: "Web", Command: []string{"true"}, Status: 1},
+			}
+			for _, log := range logs {
+				if err := store.append(log); err != nil {
+					t.Fatalf("append failed: %v", err)
+				}
+			}
+
+			day, err := store.readDay(now.Format("20060102"))
+			if err != nil {
+				t.Fatalf("readDay failed: %v", err)
+			}
+			if len(day) != 3 || day[0].Duration != 0.5 || day[1].Name != "DB" || day[1].Command[0] != "false" {
+				t.Errorf("readDay = %+v", day)
+			}
+			if !day[0].Time.Equal(logs[1].Time) {
+				t.Errorf("Time = %v, want %v", day[0].Time, logs[1].Time)
+			}
+
+			got, err := store.query("", "Web", "API", yesterday, now)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			// 終了時刻は含まない
+			if len(got) != 2 || got[0].Message != "down" || got[1].Status != 0 {
+				t.Errorf("query = %+v, want 2 logs of API", got)
+			}
+			// ログのない日は読まないので、長い期間でもすぐに返る
+			got, err = store.query("", "Web", "API", now.AddDate(-200, 0, 0), now.AddDate(200, 0, 0))
+			if err != nil || len(got) != 3 {
+				t.Errorf("query of the long range = %d logs, %v", len(got), err)
+			}
+		})
+	}
+}
+
+func TestRenderStatusPage_SQLite(t *testing.T) {
+	opt := newTestOpt(t)
+	opt.Storage = "sqlite"
+	store, err := newLogStore(opt.Storage, opt.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	opt.store = store
+	if err := opt.createServiceLog(); err != nil {
+		t.Fatalf("createServiceLog failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opt.Data, sqliteFileName)); err != nil {
+		t.Fatalf("database not found: %v", err)
+	}
+
+	svc := opt.config.Categories[0].Services[0]
+	if err := opt.appendServiceLog(&ServiceLog{Time: time.Now(), Name: "Google", CategoryName: "Web", Command: svc.Command, Status: 2}); err != nil {
+		t.Fatalf("appendServiceLog failed: %v", err)
+	}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	if svc.LatestStatus != Outage {
+		t.Errorf("LatestStatus = %v, want Outage", svc.LatestStatus)
+	}
+	// ログファイルは作らない
+	matches, _ := filepath.Glob(filepath.Join(opt.Data, "log*.txt"))
+	if len(matches) != 0 {
+		t.Errorf("log files should not be created: %v", matches)
+	}
+}
+
+func TestSQLiteStore_MigrateSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqliteFileName)
+	store, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// service_id と category_id を持たない最初のスキーマ
+	if _, err := store.db.Exec(`CREATE TABLE service_logs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	day TEXT NOT NULL,
+	time INTEGER NOT NULL,
+	category_name TEXT NOT NULL,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	duration REAL NOT NULL
+)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := store.db.Exec(`INSERT INTO service_logs (day, time, category_name, name, command, status, message, duration) VALUES (?, ?, 'Web', 'API', '["true"]', 0, '', 0)`,
+		now.Format("20060102"), now.UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.append(&ServiceLog{Time: now, ServiceID: "api", CategoryName: "Web", Name: "API", Command: []string{"true"}}); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := store.query("api", "Web", "API", now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil || len(logs) != 2 || logs[0].ServiceID != "" || logs[1].ServiceID != "api" {
+		t.Errorf("query = %+v, %v", logs, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	_ "embed"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pkg/errors"
+)
+
+//go:embed files/index.html
+var indexhtml []byte
+
+//go:embed files/service.html
+var servicehtml []byte
+
+// templateFuncs are the helper functions available in the templates in addition to the builtin ones
+var templateFuncs = template.FuncMap{
+	"formatTime": func(t time.Time, layout string) string {
+		return t.Format(layout)
+	},
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"markdown": func(s string) (string, error) {
+		m := &markdown{}
+		if err := m.UnmarshalText([]byte(s)); err != nil {
+			return "", err
+		}
+		return m.html, nil
+	},
+	"asset": assets.path,
+	"static": func(name string) string {
+		return "/static/" + strings.TrimPrefix(name, "/")
+	},
+}
+
+var defaultTemplates = template.Must(parseTemplates(""))
+
+// localizedFuncs are replaced for each locale by localizeTemplates. the default ones render the page in English
+var localizedFuncs = (&locale{lang: "en", catalog: defaultCatalog}).funcs()
+
+// parseTemplates parses the embedded templates, and then the *.html files in dir.
+// templates defined in dir replace the embedded ones with the same name
+func parseTemplates(dir string) (*template.Template, error) {
+	t := template.New("statusboard").Funcs(templateFuncs).Funcs(localizedFuncs)
+	for _, src := range [][]byte{indexhtml, servicehtml} {
+		if _, err := t.Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return t, nil
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open template_dir")
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("%s is not a directory", dir)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read template")
+		}
+		// {{ define "index" }} のように名前を付けて定義したテンプレートが組み込みのものを置き換える
+		if _, err := t.New(filepath.Base(file)).Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// template returns the templates for the locale of the key. the embedded ones if the configuration is not loaded from toml
+func (c *Config) template(key string) *template.Template {
+	if t, ok := c.templates[key]; ok {
+		return t
+	}
+	if t, ok := c.templates[""]; ok {
+		return t
+	}
+	return defaultTemplates
+}
+
+// handleStatic serves the files in static_dir under /static/
+func (o *Opt) handleStatic(c *echo.Context) error {
+	o.rwlock.RLock()
+	dir := o.config.StaticDir
+	o.rwlock.RUnlock()
+	if dir == "" {
+		return echo.ErrNotFound
+	}
+	return echo.StaticDirectoryHandler(os.DirFS(dir), false)(c)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCustomTemplates(t *testing.T) {
+	dir := t.TempDir()
+	templateDir := filepath.Join(dir, "templates")
+	staticDir := filepath.Join(dir, "static")
+	for _, d := range []string{templateDir, staticDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// index だけを置き換え、service は組み込みのものを使う
+	if err := os.WriteFile(filepath.Join(templateDir, "index.html"), []byte(`{{ define "index" }}<title>{{ upper .Title }}</title>
+<link rel="stylesheet" href="{{ static "corp.css" }}">
+{{ range .Categories }}{{ range .Services }}{{ template "service-name" . }}{{ end }}{{ end }}{{ end }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "partials.html"), []byte(`{{ define "service-name" }}<span class="corp">{{ .Name }}</span>{{ end }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staticDir, "corp.css"), []byte("body { color: red }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := loadToml(writeTempToml(t, `
+title = "Corp Status"
+template_dir = "`+templateDir+`"
+static_dir = "`+staticDir+`"
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+	if err := opt.renderStatusPage(context.Background()); err != nil {
+		t.Fatalf("renderStatusPage failed: %v", err)
+	}
+	want := "<title>CORP STATUS</title>\n<link rel=\"stylesheet\" href=\"/static/corp.css\">\n<span class=\"corp\">API</span>"
+	if string(opt.htmlBlob) != want {
+		t.Errorf("htmlBlob = %q, want %q", opt.htmlBlob, want)
+	}
+
+	e := opt.buildHandler()
+	for path, want := range map[string]int{
+		"/static/corp.css":         http.StatusOK,
+		"/static/missing.css":      http.StatusNotFound,
+		"/static/../test.toml":     http.StatusNotFound,
+		"/static/%2e%2e/test.toml": http.StatusNotFound,
+		"/services/Web/API":        http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestCustomTemplates_Invalid(t *testing.T) {
+	templateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templateDir, "index.html"), []byte(`{{ define "index" }}{{ .Title }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, problems := checkToml(writeTempToml(t, `
+title = "Corp Status"
+template_dir = "`+templateDir+`"
+static_dir = "/nonexistent"
+`))
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v, want 2 problems", problems)
+	}
+	if p := problems[0]; p.Severity != severityError || p.Line != 3 || !strings.Contains(p.Message, "index.html:1") {
+		t.Errorf("problems[0] = %v, want the parse error of the template", p)
+	}
+	if p := problems[1]; p.Severity != severityWarning || p.Line != 4 {
+		t.Errorf("problems[1] = %v, want a warning of static_dir", p)
+	}
+
+	// 静的ファイルのディレクトリがなければ404
+	rec := httptest.NewRecorder()
+	(&Opt{config: &Config{}}).buildHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/corp.css", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /static/corp.css = %d, want 404", rec.Code)
+	}
+}
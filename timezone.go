@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	// タイムゾーンのデータベースがないコンテナでも timezone を使えるようにする
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+)
+
+// timezoneFileName records the time zone which the logs in the data dir are split by
+const timezoneFileName = "timezone"
+
+// rebucketLogs moves the logs to the days in loc, and returns the number of the moved logs.
+// the summaries of the days without the raw logs cannot be split and are kept as they are
+func rebucketLogs(store logStore, loc *time.Location) (int, error) {
+	logDays, _, err := store.days()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list logs")
+	}
+	dayIn := func(log *ServiceLog) string {
+		return log.Time.In(loc).Format("20060102")
+	}
+	// 移動するログだけを持っておき、影響のある日をまとめて書き直す
+	incoming := map[string][]*ServiceLog{}
+	changed := map[string]bool{}
+	moved := 0
+	for _, day := range logDays {
+		logs, err := store.readDay(day)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return moved, errors.Wrapf(err, "failed to read logs of %s", day)
+		}
+		for _, log := range logs {
+			if d := dayIn(log); d != day {
+				incoming[d] = append(incoming[d], log)
+				changed[day], changed[d] = true, true
+				moved++
+			}
+		}
+	}
+	for _, day := range slices.Sorted(maps.Keys(changed)) {
+		logs, err := store.readDay(day)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return moved, errors.Wrapf(err, "failed to read logs of %s", day)
+		}
+		kept := []*ServiceLog{}
+		for _, log := range logs {
+			if dayIn(log) == day {
+				kept = append(kept, log)
+			}
+		}
+		kept = append(kept, incoming[day]...)
+		slices.SortStableFunc(kept, func(a, b *ServiceLog) int {
+			return a.Time.Compare(b.Time)
+		})
+		if len(kept) == 0 {
+			err = store.deleteLogs(day)
+		} else {
+			err = store.replaceDay(day, kept)
+		}
+		if err != nil {
+			return moved, errors.Wrapf(err, "failed to write logs of %s", day)
+		}
+	}
+	return moved, nil
+}
+
+// migrateTimezone splits the existing logs again by the local time zone if it differs from the recorded one.
+// must be called before the logs are read or written
+func (o *Opt) migrateTimezone() error {
+	path := filepath.Join(o.Data, timezoneFileName)
+	current := time.Local.String()
+	// 記録がなければサーバのタイムゾーンで書かれている
+	previous := "Local"
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		previous = strings.TrimSpace(string(b))
+		if previous == current {
+			return nil
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return errors.Wrap(err, "could not read timezone")
+	}
+	if previous != current {
+		n, err := rebucketLogs(o.logStore(), time.Local)
+		if err != nil {
+			return err
+		}
+		slog.Info("logs are split by the new timezone", slog.String("from", previous), slog.String("to", current), slog.Int("moved", n))
+	}
+	return writeFileAtomic(path, []byte(current+"\n"))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebucketLogs(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	for _, storage := range []string{"file", "sqlite"} {
+		t.Run(storage, func(t *testing.T) {
+			store, err := newLogStore(storage, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if err := store.init(); err != nil {
+				t.Fatal(err)
+			}
+			// UTCで分けられていたログ
+			logAt := func(s string) *ServiceLog {
+				tm, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return &ServiceLog{Time: tm, Name: "Google", CategoryName: "Web", Status: 0}
+			}
+			for day, logs := range map[string][]*ServiceLog{
+				"20261016": {logAt("2026-10-16T20:00:00Z")},
+				"20261017": {logAt("2026-10-17T01:00:00Z"), logAt("2026-10-17T20:00:00Z")},
+				"20261018": {logAt("2026-10-18T01:00:00Z")},
+			} {
+				if err := store.replaceDay(day, logs); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			n, err := rebucketLogs(store, jst)
+			if err != nil {
+				t.Fatalf("rebucketLogs failed: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("moved = %d, want 2", n)
+			}
+			want := map[string][]string{
+				"20261016": nil,
+				"20261017": {"2026-10-16T20:00:00Z", "2026-10-17T01:00:00Z"},
+				"20261018": {"2026-10-17T20:00:00Z", "2026-10-18T01:00:00Z"},
+			}
+			for day, times := range want {
+				logs, _ := store.readDay(day)
+				got := []string{}
+				for _, log := range logs {
+					got = append(got, log.Time.UTC().Format(time.RFC3339))
+				}
+				if strings.Join(got, ",") != strings.Join(times, ",") {
+					t.Errorf("logs of %s = %v, want %v", day, got, times)
+				}
+			}
+			// 空になった日は消す
+			days, _, err := store.days()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(days, ",") != "20261017,20261018" {
+				t.Errorf("days = %v", days)
+			}
+
+			// 分け直した後は何も移動しない
+			if n, err := rebucketLogs(store, jst); err != nil || n != 0 {
+				t.Errorf("rebucketLogs again = %d, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestMigrateTimezone(t *testing.T) {
+	opt := newTestOpt(t)
+	if err := opt.createServiceLog(); err != nil {
+		t.Fatalf("createServiceLog failed: %v", err)
+	}
+	path := filepath.Join(opt.Data, timezoneFileName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("timezone should be recorded: %v", err)
+	}
+	if strings.TrimSpace(string(b)) != time.Local.String() {
+		t.Errorf("timezone = %q, want %q", b, time.Local.String())
+	}
+
+	// 記録と違えば分け直して記録し直す
+	if err := os.WriteFile(path, []byte("Asia/Tokyo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.migrateTimezone(); err != nil {
+		t.Fatalf("migrateTimezone failed: %v", err)
+	}
+	if b, _ := os.ReadFile(path); strings.TrimSpace(string(b)) != time.Local.String() {
+		t.Errorf("timezone = %q, want %q", b, time.Local.String())
+	}
+}
+
+func TestTimezoneConfig(t *testing.T) {
+	conf, err := loadToml(writeTempToml(t, `timezone = "Asia/Tokyo"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.location == nil || conf.location.String() != "Asia/Tokyo" {
+		t.Errorf("location = %v, want Asia/Tokyo", conf.location)
+	}
+
+	_, problems := checkToml(writeTempToml(t, "title = \"Status\"\ntimezone = \"Mars/Olympus\""))
+	if len(problems) != 1 || problems[0].Severity != severityError || problems[0].Line != 2 {
+		t.Errorf("problems = %v, want an error of timezone at line 2", problems)
+	}
+}
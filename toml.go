@@ -2,10 +2,18 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"html/template"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -81,6 +89,10 @@ func (m *markdown) UnmarshalText(source []byte) error {
 	return nil
 }
 
+func (m *markdown) MarshalText() ([]byte, error) {
+	return []byte(m.original), nil
+}
+
 func (m *markdown) HTML() template.HTML {
 	return template.HTML(m.html)
 }
@@ -90,71 +102,249 @@ func (m *markdown) IsEmpty() bool {
 }
 
 type Config struct {
-	Lang             string      `toml:"lang" json:"-"`
-	Title            string      `toml:"title" json:"title"`
-	Favicon          string      `toml:"favicon"`
-	NavTitle         *markdown   `toml:"nav_title" json:"-"`
-	NavButtonName    string      `toml:"nav_button_name" json:"-"`
-	NavButtonLink    string      `toml:"nav_button_link" json:"-"`
-	HeaderMessage    *markdown   `toml:"header_message" json:"-"`
-	FooterMessage    *markdown   `toml:"footer_message" json:"-"`
-	PoweredBy        *markdown   `toml:"powered_by" json:"-"`
-	Categories       []*Category `toml:"category" json:"categories"`
-	WorkerInterval   duration    `toml:"worker_interval" json:"-"`
-	WorkerTimeout    duration    `toml:"worker_timeout" json:"-"`
-	NumOfWorker      int         `toml:"num_of_worker" json:"-"`
-	MaxCheckAttempts int         `toml:"max_check_attempts" json:"-"`
-	RetryInterval    duration    `toml:"retry_interval" json:"-"`
-	LatestTimeRange  duration    `toml:"latest_time_range" json:"-"`
-	Days             []string    `json:"days"`
-	LastUpdatedAt    time.Time   `json:"last_updated_at"`
+	Lang             string         `toml:"lang" json:"-"`
+	Title            string         `toml:"title" json:"title"`
+	Favicon          string         `toml:"favicon"`
+	NavTitle         *markdown      `toml:"nav_title" json:"-"`
+	NavButtonName    string         `toml:"nav_button_name" json:"-"`
+	NavButtonLink    string         `toml:"nav_button_link" json:"-"`
+	HeaderMessage    *markdown      `toml:"header_message" json:"-"`
+	FooterMessage    *markdown      `toml:"footer_message" json:"-"`
+	PoweredBy        *markdown      `toml:"powered_by" json:"-"`
+	TemplateDir      string         `toml:"template_dir" json:"-"`
+	StaticDir        string         `toml:"static_dir" json:"-"`
+	Assets           string         `toml:"assets" json:"-"`
+	AcceptLanguage   bool           `toml:"accept_language" json:"-"`
+	Timezone         string         `toml:"timezone" json:"-"`
+	Categories       []*Category    `toml:"category" json:"categories"`
+	WorkerInterval   duration       `toml:"worker_interval" json:"-"`
+	WorkerTimeout    duration       `toml:"worker_timeout" json:"-"`
+	NumOfWorker      int            `toml:"num_of_worker" json:"-"`
+	MaxCheckAttempts int            `toml:"max_check_attempts" json:"-"`
+	RetryInterval    duration       `toml:"retry_interval" json:"-"`
+	LatestTimeRange  duration       `toml:"latest_time_range" json:"-"`
+	HistoryDays      int            `toml:"history_days" json:"-"`
+	Maintenance      []*Maintenance `toml:"maintenance" json:"-"`
+	Notification     *Notification  `toml:"notification" json:"-"`
+	Retention        *Retention     `toml:"retention" json:"-"`
+	Days             []string       `json:"days"`
+	Incidents        []*Incident    `json:"incidents"`
+	// active and upcoming maintenance windows
+	ScheduledMaintenances []*Maintenance `toml:"-" json:"maintenances"`
+	LastUpdatedAt         time.Time      `json:"last_updated_at"`
+	// result of the last reload. nil until the configuration is reloaded
+	LastReload *ReloadStatus `toml:"-" json:"last_reload,omitempty"`
+	// time zone of timezone. nil for the local time zone of the server
+	location *time.Location
+	// language of the messages in the page
+	messageLang string
+	// the days of Days for the localized formats
+	dates []time.Time
+	// templates parsed with template_dir for each locale
+	templates map[string]*texttemplate.Template
+}
+
+// maxHistoryDays is the upper limit of history_days
+const maxHistoryDays = 365
+
+// timelineThreshold is the number of days above which the history is shown as a bar timeline
+const timelineThreshold = 14
+
+// UseTimeline reports whether the history is too long for the table
+func (c *Config) UseTimeline() bool {
+	return c.HistoryDays > timelineThreshold
 }
 
 type Category struct {
+	// stable identifier kept in the logs. optional
+	ID           string      `toml:"id" json:"id,omitempty"`
 	Name         string      `toml:"name" json:"name"`
 	Comment      string      `toml:"comment" json:"comment"`
 	Services     []*Service  `toml:"service" json:"services"`
 	LatestStatus *statusText `json:"latest_status"`
 	Hide         bool        `toml:"hide" json:"-"`
+	// aggregated over the services in this category
+	UptimeHistory []Uptime      `json:"uptime_history"`
+	Uptime        UptimeSummary `json:"uptime"`
+
+	// overrides of the top-level values for the services in this category
+	WorkerInterval   duration `toml:"worker_interval" json:"-"`
+	WorkerTimeout    duration `toml:"worker_timeout" json:"-"`
+	MaxCheckAttempts int      `toml:"max_check_attempts" json:"-"`
+	RetryInterval    duration `toml:"retry_interval" json:"-"`
 }
 
 type Service struct {
-	categoryName   string
-	Name           string        `toml:"name" json:"name"`
-	Command        []string      `toml:"command" json:"-"`
-	LatestStatus   *statusText   `json:"latest_status"`
-	LatestStatusAt time.Time     `json:"latest_status_at"`
-	StatusHistory  []*statusText `json:"status_history"`
+	categoryName string
+	categoryID   string
+	// stable identifier kept in the logs, used to match the logs instead of the name and command. optional
+	ID             string         `toml:"id" json:"id,omitempty"`
+	Name           string         `toml:"name" json:"name"`
+	Type           string         `toml:"type" json:"-"`
+	Command        []string       `toml:"command" json:"-"`
+	LatestStatus   *statusText    `json:"latest_status"`
+	LatestStatusAt time.Time      `json:"latest_status_at"`
+	StatusHistory  []*statusText  `json:"status_history"`
+	UptimeHistory  []Uptime       `json:"uptime_history"`
+	Timeline       []*timelineDay `json:"-"`
+	Uptime         UptimeSummary  `json:"uptime"`
+	Latency        Latency        `json:"latency"`
+	maintenances   []*Maintenance
+
+	// overrides of the category or top-level values
+	WorkerInterval   duration `toml:"worker_interval" json:"-"`
+	WorkerTimeout    duration `toml:"worker_timeout" json:"-"`
+	MaxCheckAttempts int      `toml:"max_check_attempts" json:"-"`
+	RetryInterval    duration `toml:"retry_interval" json:"-"`
+
+	// exit codes not listed in either are treated as Outage
+	OperationalExitCodes []int `toml:"operational_exit_codes" json:"-"`
+	DegradedExitCodes    []int `toml:"degraded_exit_codes" json:"-"`
+
+	// hide the output of the checks on the drill-down page and the API
+	HideOutput bool `toml:"hide_output" json:"-"`
+
+	// type = "http"
+	URL            string            `toml:"url" json:"-"`
+	Method         string            `toml:"method" json:"-"`
+	Headers        map[string]string `toml:"headers" json:"-"`
+	ExpectedStatus []int             `toml:"expected_status" json:"-"`
+	BodyContains   string            `toml:"body_contains" json:"-"`
+	BodyRegexp     string            `toml:"body_regexp" json:"-"`
+
+	// type = "tcp", "tls"
+	Address            string   `toml:"address" json:"-"`
+	CertExpiryWarning  duration `toml:"cert_expiry_warning" json:"-"`
+	CertExpiryCritical duration `toml:"cert_expiry_critical" json:"-"`
+
+	// type = "dns"
+	Query      string   `toml:"query" json:"-"`
+	RecordType string   `toml:"record_type" json:"-"`
+	Resolver   string   `toml:"resolver" json:"-"`
+	Expected   []string `toml:"expected" json:"-"`
+
+	// common to built-in checks
+	TLSSkipVerify   bool     `toml:"tls_skip_verify" json:"-"`
+	TLSServerName   string   `toml:"tls_server_name" json:"-"`
+	TLSCAFile       string   `toml:"tls_ca_file" json:"-"`
+	Timeout         duration `toml:"timeout" json:"-"`
+	bodyRegexp      *regexp.Regexp
+	httpClient      *http.Client
+	tlsClientConfig *tls.Config
+	resolver        *net.Resolver
+}
+
+// statusByCode maps an exit code of the check to the status
+func (s *Service) statusByCode(code int) *statusText {
+	if s.OperationalExitCodes == nil {
+		if code == CheckOK {
+			return Operational
+		}
+	} else if slices.Contains(s.OperationalExitCodes, code) {
+		return Operational
+	}
+	if slices.Contains(s.DegradedExitCodes, code) {
+		return Degraded
+	}
+	return Outage
 }
 
 type ServiceLog struct {
 	Time         time.Time `json:"time"`
+	CategoryID   string    `json:"category_id,omitempty"`
 	CategoryName string    `json:"category_name"`
+	ServiceID    string    `json:"service_id,omitempty"`
 	Name         string    `json:"name"`
 	Command      []string  `json:"command"`
 	Status       int       `json:"status"`
 	Message      string    `json:"message"`
+	// seconds taken by the check including retries. 0 in logs written by old versions
+	Duration float64 `json:"duration,omitempty"`
+}
+
+var idRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// validateID checks the format of the id and that it is not in seen
+func validateID(id string, seen map[string]bool) error {
+	if id == "" {
+		return nil
+	}
+	if !idRegexp.MatchString(id) {
+		return errors.Errorf("id %q must consist of alphanumerics, '_', '.' and '-'", id)
+	}
+	if seen[id] {
+		return errors.Errorf("duplicate id %q", id)
+	}
+	seen[id] = true
+	return nil
 }
 
 func loadToml(path string) (*Config, error) {
-	file, err := os.Open(path)
+	conf, problems := checkToml(path)
+	for _, p := range problems.filter(severityWarning) {
+		slog.Warn("problem in toml", slog.String("toml", path), slog.Int("line", p.Line), slog.String("message", p.Message))
+	}
+	if problems.hasError() {
+		return nil, problems
+	}
+	return conf, nil
+}
+
+// checkDurations reports negative durations. durations are checked before the defaults are applied
+func checkDurations(src *tomlSource, path string, n int, ps *configProblems, durations map[string]duration) {
+	for _, key := range slices.Sorted(maps.Keys(durations)) {
+		if durations[key].Duration < 0 {
+			ps.errorf(src.line(path, n, key), "%s must not be negative", key)
+		}
+	}
+}
+
+// checkTimings reports the combination of durations which does not work as expected
+func checkTimings(src *tomlSource, path string, n int, ps *configProblems, name string, interval, timeout, retry duration, attempts int) {
+	if interval.Duration < 0 || timeout.Duration < 0 || retry.Duration < 0 {
+		// 負の値はエラーとして報告済み
+		return
+	}
+	if timeout.Duration > interval.Duration {
+		ps.warnf(src.line(path, n, "worker_timeout"), "worker_timeout %s of %s is longer than worker_interval %s", timeout.Duration, name, interval.Duration)
+	}
+	if attempts > 1 && retry.Duration*time.Duration(attempts-1) >= timeout.Duration {
+		ps.warnf(src.line(path, n, "retry_interval"), "retries of %s cannot finish within worker_timeout %s", name, timeout.Duration)
+	}
+}
+
+// checkToml loads the toml file and reports all problems found in it. the configuration is nil if there is an error
+func checkToml(path string) (*Config, configProblems) {
+	problems := configProblems{}
+	b, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not open toml")
+		problems.errorf(0, "could not open toml: %v", err)
+		return nil, problems
 	}
-	defer file.Close()
 
 	var conf Config
-	if _, err := toml.NewDecoder(file).Decode(&conf); err != nil {
-		return nil, errors.Wrap(err, "failed to decode toml")
+	md, err := toml.Decode(string(b), &conf)
+	if err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			problems = append(problems, &configProblem{Severity: severityError, Line: pe.Position.Line, Column: pe.Position.Col, Message: "failed to decode toml: " + pe.Message})
+		} else {
+			problems.errorf(0, "failed to decode toml: %v", err)
+		}
+		return nil, problems
 	}
+	src := parseTomlSource(string(b))
+	src.undecoded(md, &problems)
 
-	for _, category := range conf.Categories {
-		for _, service := range category.Services {
-			service.categoryName = category.Name
-			if len(service.Command) == 0 {
-				return nil, errors.Errorf("service %s in category %s has no command", service.Name, category.Name)
-			}
-		}
+	checkDurations(src, "", 0, &problems, map[string]duration{
+		"worker_interval": conf.WorkerInterval, "worker_timeout": conf.WorkerTimeout,
+		"retry_interval": conf.RetryInterval, "latest_time_range": conf.LatestTimeRange,
+	})
+	if md.IsDefined("num_of_worker") && conf.NumOfWorker < 1 {
+		problems.errorf(src.line("", 0, "num_of_worker"), "num_of_worker must be 1 or more")
+	}
+	if conf.MaxCheckAttempts < 0 {
+		problems.errorf(src.line("", 0, "max_check_attempts"), "max_check_attempts must not be negative")
 	}
 
 	if conf.NumOfWorker == 0 {
@@ -169,6 +359,12 @@ func loadToml(path string) (*Config, error) {
 	if conf.LatestTimeRange.IsZero() {
 		conf.LatestTimeRange = MustDuration("1h")
 	}
+	if conf.HistoryDays == 0 {
+		conf.HistoryDays = 7
+	}
+	if conf.HistoryDays < 0 || conf.HistoryDays > maxHistoryDays {
+		problems.errorf(src.line("", 0, "history_days"), "history_days must be between 1 and %d", maxHistoryDays)
+	}
 
 	if conf.MaxCheckAttempts == 0 {
 		conf.MaxCheckAttempts = 3
@@ -176,8 +372,162 @@ func loadToml(path string) (*Config, error) {
 	if conf.RetryInterval.IsZero() {
 		conf.RetryInterval = MustDuration("5s")
 	}
+
+	categoryIDs := map[string]bool{}
+	serviceIDs := map[string]bool{}
+	categoryNames := map[string]bool{}
+	// ワーカー、通知、ログはカテゴリ名とサービス名でサービスを区別するので、重複は起動できない
+	serviceNames := map[string]bool{}
+	// [[category.service]] の通し番号
+	serviceIndex := 0
+	for i, category := range conf.Categories {
+		line := func(key string) int { return src.line("category", i, key) }
+		if err := validateID(category.ID, categoryIDs); err != nil {
+			problems.errorf(line("id"), "category %s: %v", category.Name, err)
+		}
+		if categoryNames[category.Name] {
+			problems.warnf(line("name"), "duplicate category name %q", category.Name)
+		}
+		categoryNames[category.Name] = true
+		checkDurations(src, "category", i, &problems, map[string]duration{
+			"worker_interval": category.WorkerInterval, "worker_timeout": category.WorkerTimeout, "retry_interval": category.RetryInterval,
+		})
+		if category.MaxCheckAttempts < 0 {
+			problems.errorf(line("max_check_attempts"), "max_check_attempts of category %s must not be negative", category.Name)
+		}
+		if category.WorkerInterval.IsZero() {
+			category.WorkerInterval = conf.WorkerInterval
+		}
+		if category.WorkerTimeout.IsZero() {
+			category.WorkerTimeout = conf.WorkerTimeout
+		}
+		if category.MaxCheckAttempts == 0 {
+			category.MaxCheckAttempts = conf.MaxCheckAttempts
+		}
+		if category.RetryInterval.IsZero() {
+			category.RetryInterval = conf.RetryInterval
+		}
+		for _, service := range category.Services {
+			n := serviceIndex
+			serviceIndex++
+			line := func(key string) int { return src.line("category.service", n, key) }
+			name := fmt.Sprintf("service %s in category %s", service.Name, category.Name)
+			service.categoryName = category.Name
+			service.categoryID = category.ID
+			if err := validateID(service.ID, serviceIDs); err != nil {
+				problems.errorf(line("id"), "%s: %v", name, err)
+			}
+			if serviceNames[serviceKey(service)] {
+				problems.errorf(line("name"), "duplicate service name %q in category %s", service.Name, category.Name)
+			}
+			serviceNames[serviceKey(service)] = true
+			checkDurations(src, "category.service", n, &problems, map[string]duration{
+				"worker_interval": service.WorkerInterval, "worker_timeout": service.WorkerTimeout, "retry_interval": service.RetryInterval,
+			})
+			if service.MaxCheckAttempts < 0 {
+				problems.errorf(line("max_check_attempts"), "max_check_attempts of %s must not be negative", name)
+			}
+			if service.WorkerInterval.IsZero() {
+				service.WorkerInterval = category.WorkerInterval
+			}
+			if service.WorkerTimeout.IsZero() {
+				service.WorkerTimeout = category.WorkerTimeout
+			}
+			if service.MaxCheckAttempts == 0 {
+				service.MaxCheckAttempts = category.MaxCheckAttempts
+			}
+			if service.RetryInterval.IsZero() {
+				service.RetryInterval = category.RetryInterval
+			}
+			checkTimings(src, "category.service", n, &problems, name, service.WorkerInterval, service.WorkerTimeout, service.RetryInterval, service.MaxCheckAttempts)
+			var err error
+			switch service.Type {
+			case "", "command":
+				if len(service.Command) == 0 {
+					problems.errorf(line("command"), "%s has no command", name)
+				} else {
+					checkCommand(service.Command[0], line("command"), &problems)
+				}
+			case "http":
+				err = service.prepareHTTPCheck()
+			case "tcp":
+				err = service.prepareTCPCheck()
+			case "tls":
+				err = service.prepareTLSCheck()
+			case "dns":
+				err = service.prepareDNSCheck()
+			default:
+				problems.errorf(line("type"), "%s has unknown type %q", name, service.Type)
+			}
+			if err != nil {
+				problems.errorf(line("type"), "%s: %v", name, err)
+			}
+			if service.DegradedExitCodes == nil && service.Type != "" && service.Type != "command" {
+				// 組み込みチェックの警告はDegradedとして扱う
+				service.DegradedExitCodes = []int{CheckWarning}
+			}
+		}
+	}
+
+	if conf.Notification != nil {
+		if err := conf.Notification.prepare(); err != nil {
+			problems.errorf(src.line("notification", 0, ""), "notification: %v", err)
+		}
+	}
+
+	if conf.Retention != nil {
+		if err := conf.Retention.prepare(); err != nil {
+			problems.errorf(src.line("retention", 0, ""), "retention: %v", err)
+		}
+	}
+
+	for i, m := range conf.Maintenance {
+		if err := m.validate(&conf); err != nil {
+			problems.errorf(src.line("maintenance", i, ""), "maintenance %q: %v", m.Description, err)
+		}
+	}
+	if conf.Timezone != "" {
+		loc, err := time.LoadLocation(conf.Timezone)
+		if err != nil {
+			problems.errorf(src.line("", 0, "timezone"), "timezone: %v", err)
+		}
+		conf.location = loc
+	}
+	switch conf.Assets {
+	case "":
+		conf.Assets = assetsEmbedded
+	case assetsEmbedded, assetsCDN:
+	default:
+		problems.errorf(src.line("", 0, "assets"), "assets must be %q or %q", assetsEmbedded, assetsCDN)
+	}
+	templates, err := parseTemplates(conf.TemplateDir)
+	if err != nil {
+		problems.errorf(src.line("", 0, "template_dir"), "template_dir: %v", err)
+	}
+	if conf.StaticDir != "" {
+		if fi, err := os.Stat(conf.StaticDir); err != nil || !fi.IsDir() {
+			problems.warnf(src.line("", 0, "static_dir"), "static_dir %s is not a directory", conf.StaticDir)
+		}
+	}
+
+	// 設定ファイルの上から順に並べる
+	slices.SortStableFunc(problems, func(a, b *configProblem) int {
+		return a.Line - b.Line
+	})
+	if problems.hasError() {
+		return nil, problems
+	}
+
+	conf.messageLang = conf.Lang
 	if conf.Lang == "" {
+		// 指定がなければこれまで通り表示は英語にする
 		conf.Lang = "ja"
+		conf.messageLang = "en"
+	}
+	conf.templates, err = localizeTemplates(templates, conf.locales())
+	if err != nil {
+		problems.errorf(src.line("", 0, "template_dir"), "template_dir: %v", err)
+		return nil, problems
 	}
 	if conf.Title == "" {
 		conf.Title = "Status Board"
@@ -202,5 +552,5 @@ func loadToml(path string) (*Config, error) {
 	}
 	conf.LastUpdatedAt = time.Now()
 
-	return &conf, nil
+	return &conf, problems
 }
@@ -171,3 +171,106 @@ name = "Cat"
 		t.Fatal("expected error for missing command, got nil")
 	}
 }
+
+func TestLoadToml_ExitCodes(t *testing.T) {
+	tomlContent := `
+[[category]]
+name = "Cat"
+  [[category.service]]
+  name = "Nagios"
+  command = ["check_something"]
+  degraded_exit_codes = [1]
+
+  [[category.service]]
+  name = "Plain"
+  command = ["true"]
+
+  [[category.service]]
+  name = "TLS"
+  type = "tls"
+  address = "example.com:443"
+`
+	path := writeTempToml(t, tomlContent)
+	conf, err := loadToml(path)
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	nagios := conf.Categories[0].Services[0]
+	plain := conf.Categories[0].Services[1]
+	tlsCheck := conf.Categories[0].Services[2]
+	cases := []struct {
+		service *Service
+		code    int
+		want    *statusText
+	}{
+		{nagios, 0, Operational},
+		{nagios, 1, Degraded},
+		{nagios, 2, Outage},
+		{plain, 0, Operational},
+		{plain, 1, Outage},
+		{tlsCheck, CheckWarning, Degraded},
+		{tlsCheck, CheckCritical, Outage},
+	}
+	for _, c := range cases {
+		if got := c.service.statusByCode(c.code); got != c.want {
+			t.Errorf("%s: statusByCode(%d) = %v, want %v", c.service.Name, c.code, got, c.want)
+		}
+	}
+}
+
+func TestLoadToml_ServiceOverrides(t *testing.T) {
+	tomlContent := `
+worker_interval = "5m"
+worker_timeout = "30s"
+max_check_attempts = 3
+retry_interval = "5s"
+
+[[category]]
+name = "Batch"
+worker_interval = "1h"
+worker_timeout = "10m"
+
+  [[category.service]]
+  name = "Nightly"
+  command = ["true"]
+
+  [[category.service]]
+  name = "Hourly"
+  command = ["true"]
+  worker_timeout = "2m"
+  max_check_attempts = 1
+
+[[category]]
+name = "Web"
+
+  [[category.service]]
+  name = "Ping"
+  command = ["true"]
+  retry_interval = "1s"
+`
+	path := writeTempToml(t, tomlContent)
+	conf, err := loadToml(path)
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	cases := []struct {
+		service          *Service
+		interval         time.Duration
+		timeout          time.Duration
+		maxCheckAttempts int
+		retryInterval    time.Duration
+	}{
+		{conf.Categories[0].Services[0], time.Hour, 10 * time.Minute, 3, 5 * time.Second},
+		{conf.Categories[0].Services[1], time.Hour, 2 * time.Minute, 1, 5 * time.Second},
+		{conf.Categories[1].Services[0], 5 * time.Minute, 30 * time.Second, 3, time.Second},
+	}
+	for _, c := range cases {
+		s := c.service
+		if s.WorkerInterval.Duration != c.interval || s.WorkerTimeout.Duration != c.timeout ||
+			s.MaxCheckAttempts != c.maxCheckAttempts || s.RetryInterval.Duration != c.retryInterval {
+			t.Errorf("%s: got interval=%v timeout=%v attempts=%d retry=%v, want %v %v %d %v", s.Name,
+				s.WorkerInterval, s.WorkerTimeout, s.MaxCheckAttempts, s.RetryInterval,
+				c.interval, c.timeout, c.maxCheckAttempts, c.retryInterval)
+		}
+	}
+}
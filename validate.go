@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-json"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// configProblem is a problem found in the configuration. errors make the configuration unusable
+type configProblem struct {
+	Severity string `json:"severity"`
+	// position in the toml file. 0 if unknown
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p *configProblem) String() string {
+	pos := ""
+	if p.Line > 0 {
+		pos = fmt.Sprintf("line %d: ", p.Line)
+	}
+	return fmt.Sprintf("%s%s: %s", pos, p.Severity, p.Message)
+}
+
+type configProblems []*configProblem
+
+func (ps *configProblems) errorf(line int, format string, args ...any) {
+	*ps = append(*ps, &configProblem{Severity: severityError, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps *configProblems) warnf(line int, format string, args ...any) {
+	*ps = append(*ps, &configProblem{Severity: severityWarning, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps configProblems) hasError() bool {
+	for _, p := range ps {
+		if p.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps configProblems) filter(severity string) configProblems {
+	filtered := configProblems{}
+	for _, p := range ps {
+		if p.Severity == severity {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// Error joins the errors, so that the problems can be returned as an error
+func (ps configProblems) Error() string {
+	msgs := []string{}
+	for _, p := range ps.filter(severityError) {
+		msgs = append(msgs, p.String())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type checkResponse struct {
+	OK       bool           `json:"ok"`
+	Problems configProblems `json:"problems"`
+}
+
+// checkConfig prints all problems in the configuration for --check. returns the exit code.
+// warnings fail only with --strict, as the server starts with them
+func (o *Opt) checkConfig() int {
+	_, problems := checkToml(o.Toml)
+	ok := !problems.hasError() && (!o.Strict || len(problems) == 0)
+	if o.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&checkResponse{OK: ok, Problems: problems}); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", o.Toml, strings.TrimPrefix(p.String(), "line "))
+		}
+		if ok {
+			fmt.Fprint(os.Stdout, "syntax OK\n")
+		}
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// tomlSection is a table in the toml file with the lines of its keys
+type tomlSection struct {
+	path string
+	line int
+	keys map[string]int
+}
+
+// tomlSource finds the lines of tables and keys in the toml file.
+// the toml decoder does not expose the positions of keys
+type tomlSource struct {
+	sections []*tomlSection
+}
+
+var (
+	tomlHeaderRegexp = regexp.MustCompile(`^\s*\[\[?\s*([^\[\]]+?)\s*\]\]?\s*(#.*)?$`)
+	tomlKeyRegexp    = regexp.MustCompile(`^\s*([A-Za-z0-9_\-"'. ]+?)\s*=(.*)$`)
+)
+
+func normalizeTomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+func parseTomlSource(src string) *tomlSource {
+	current := &tomlSection{line: 1, keys: map[string]int{}}
+	s := &tomlSource{sections: []*tomlSection{current}}
+	// 複数行の文字列の中は読み飛ばす
+	delimiter := ""
+	for i, line := range strings.Split(src, "\n") {
+		if delimiter != "" {
+			if strings.Contains(line, delimiter) {
+				delimiter = ""
+			}
+			continue
+		}
+		if m := tomlHeaderRegexp.FindStringSubmatch(line); m != nil {
+			current = &tomlSection{path: normalizeTomlKey(m[1]), line: i + 1, keys: map[string]int{}}
+			s.sections = append(s.sections, current)
+			continue
+		}
+		m := tomlKeyRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key := normalizeTomlKey(m[1])
+		if _, ok := current.keys[key]; !ok {
+			current.keys[key] = i + 1
+		}
+		for _, d := range []string{`"""`, `'''`} {
+			if strings.Count(m[2], d)%2 == 1 {
+				delimiter = d
+			}
+		}
+	}
+	return s
+}
+
+// section returns the n-th (0-based) table of the path
+func (s *tomlSource) section(path string, n int) *tomlSection {
+	for _, section := range s.sections {
+		if section.path != path {
+			continue
+		}
+		if n == 0 {
+			return section
+		}
+		n--
+	}
+	return nil
+}
+
+// line returns the line of the key in the n-th table of the path, or the line of the table if the key is not found
+func (s *tomlSource) line(path string, n int, key string) int {
+	section := s.section(path, n)
+	if section == nil {
+		return 0
+	}
+	if l, ok := section.keys[key]; ok {
+		return l
+	}
+	return section.line
+}
+
+// undecoded reports the keys not used by the configuration, such as typos
+func (s *tomlSource) undecoded(md toml.MetaData, ps *configProblems) {
+	undecoded := map[string]bool{}
+	for _, key := range md.Undecoded() {
+		undecoded[key.String()] = true
+	}
+	// 同じキーが配列のテーブルに複数回現れた場合は順に対応させる
+	seen := map[string]int{}
+	for _, key := range md.Undecoded() {
+		if len(key) > 1 && undecoded[key[:len(key)-1].String()] {
+			// 親のテーブルごと報告する
+			continue
+		}
+		name := key.String()
+		n := seen[name]
+		seen[name]++
+		line := 0
+		if section := s.section(name, n); section != nil {
+			line = section.line
+		} else {
+			parent, last := key[:len(key)-1].String(), key[len(key)-1]
+			for _, section := range s.sections {
+				if l, ok := section.keys[last]; ok && section.path == parent {
+					if n == 0 {
+						line = l
+						break
+					}
+					n--
+				}
+			}
+		}
+		ps.warnf(line, "unknown key %q", name)
+	}
+}
+
+// checkCommand reports the command which cannot be executed on this host
+func checkCommand(command string, line int, ps *configProblems) {
+	if !strings.Contains(command, "/") {
+		if _, err := exec.LookPath(command); err != nil {
+			ps.warnf(line, "command %q is not found in PATH", command)
+		}
+		return
+	}
+	fi, err := os.Stat(command)
+	if err != nil {
+		ps.warnf(line, "command %q is not found", command)
+		return
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		ps.warnf(line, "command %q is not executable", command)
+	}
+}
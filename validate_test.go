@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckToml(t *testing.T) {
+	_, problems := checkToml(writeTempToml(t, `
+worker_timeoout = "10s"
+num_of_worker = 0
+
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+  [[category.service]]
+  name = "API"
+  comand = ["true"]
+  command = ["/nonexistent/check_api"]
+  worker_interval = "-1m"
+`))
+	want := []string{
+		`line 2: warning: unknown key "worker_timeoout"`,
+		`line 3: error: num_of_worker must be 1 or more`,
+		`line 11: error: duplicate service name "API" in category Web`,
+		`line 12: warning: unknown key "category.service.comand"`,
+		`line 13: warning: command "/nonexistent/check_api" is not found`,
+		`line 14: error: worker_interval must not be negative`,
+	}
+	// 1回の実行で全ての問題を報告する
+	if len(problems) != len(want) {
+		for _, p := range problems {
+			t.Log(p)
+		}
+		t.Fatalf("got %d problems, want %d", len(problems), len(want))
+	}
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("problems[%d] = %q, want %q", i, p.String(), want[i])
+		}
+	}
+}
+
+func TestCheckToml_Timings(t *testing.T) {
+	_, problems := checkToml(writeTempToml(t, `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+  worker_interval = "10s"
+  worker_timeout = "30s"
+`))
+	if len(problems) == 0 || problems.hasError() || !strings.Contains(problems[0].Message, "longer than worker_interval") || problems[0].Line != 8 {
+		t.Errorf("problems = %v, want a warning of worker_timeout", problems)
+	}
+}
+
+func TestCheckToml_ParseError(t *testing.T) {
+	conf, problems := checkToml(writeTempToml(t, `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API
+`))
+	if conf != nil || len(problems) != 1 || problems[0].Severity != severityError || problems[0].Line != 5 {
+		t.Errorf("problems = %v, want a parse error at line 5", problems)
+	}
+}
+
+func TestLoadToml_Warnings(t *testing.T) {
+	// 警告だけなら読み込める
+	conf, err := loadToml(writeTempToml(t, `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+  unknown = 1
+`))
+	if err != nil || conf == nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	_, err = loadToml(writeTempToml(t, `
+worker_interval = "-1s"
+num_of_worker = -1
+`))
+	if err == nil || !strings.Contains(err.Error(), "line 2: error: worker_interval") || !strings.Contains(err.Error(), "line 3: error: num_of_worker") {
+		t.Errorf("loadToml error = %v, want both errors", err)
+	}
+}
+
+func TestCheckConfig_ExitCode(t *testing.T) {
+	warning := writeTempToml(t, `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["/nonexistent/check_api"]
+`)
+	broken := writeTempToml(t, `num_of_worker = 0`)
+	for _, tc := range []struct {
+		toml   string
+		strict bool
+		want   int
+	}{
+		// 警告だけならサーバは起動するので成功にする
+		{warning, false, 0},
+		{warning, true, 1},
+		{broken, false, 1},
+	} {
+		opt := &Opt{Toml: tc.toml, Format: "json", Strict: tc.strict}
+		if got := opt.checkConfig(); got != tc.want {
+			t.Errorf("checkConfig(%s, strict=%v) = %d, want %d", tc.toml, tc.strict, got, tc.want)
+		}
+	}
+}
+
+func TestCheckToml_DuplicateService(t *testing.T) {
+	// 同じ名前のカテゴリに分かれていても、カテゴリ名とサービス名が同じなら区別できない
+	_, problems := checkToml(writeTempToml(t, `
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+[[category]]
+name = "Web"
+  [[category.service]]
+  name = "API"
+  command = ["true"]
+`))
+	if len(problems) != 2 || problems[0].Severity != severityWarning || problems[1].String() != `line 10: error: duplicate service name "API" in category Web` {
+		t.Errorf("problems = %v, want an error of the duplicate service", problems)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"os/exec"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gammazero/workerpool"
@@ -20,7 +22,7 @@ func (o *Opt) execServiceCommand(ctx context.Context, service *Service) (int, st
 	output, err := exec.CommandContext(ctx, service.Command[0], args...).CombinedOutput()
 
 	if err != nil {
-		slog.Warn("run command error. service", slog.Any("service", service), slog.Any("error", err))
+		slog.Warn("run command error. service", slog.String("category", service.categoryName), slog.String("service", service.Name), slog.Any("command", service.Command), slog.Any("error", err))
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			return exiterr.ExitCode(), string(output), nil
 		} else {
@@ -30,16 +32,33 @@ func (o *Opt) execServiceCommand(ctx context.Context, service *Service) (int, st
 	return 0, string(output), nil
 }
 
+func (o *Opt) execServiceCheck(ctx context.Context, service *Service) (int, string, error) {
+	switch service.Type {
+	case "http":
+		return o.execHTTPCheck(ctx, service)
+	case "tcp":
+		return o.execTCPCheck(ctx, service)
+	case "tls":
+		return o.execTLSCheck(ctx, service)
+	case "dns":
+		return o.execDNSCheck(ctx, service)
+	default:
+		return o.execServiceCommand(ctx, service)
+	}
+}
+
 func (o *Opt) execServiceCommandWithRetry(ctx context.Context, service *Service) (int, string, error) {
 	var status = ErrorStatusCode
 	var output = ""
 	var err error
-	for retry := 0; retry < o.config.MaxCheckAttempts; retry++ {
-		status, output, err = o.execServiceCommand(ctx, service)
-		if status == 0 {
+	for retry := 0; retry < service.MaxCheckAttempts; retry++ {
+		status, output, err = o.execServiceCheck(ctx, service)
+		o.metrics.observeAttempt(service, service.statusByCode(status), retry > 0)
+		// 一時的な失敗を吸収するためのリトライなので、Outage以外はリトライしない
+		if !service.statusByCode(status).IsOutage() || retry+1 >= service.MaxCheckAttempts {
 			break
 		}
-		<-time.After(o.config.RetryInterval.Duration)
+		<-time.After(service.RetryInterval.Duration)
 	}
 	return status, output, err
 }
@@ -50,73 +69,158 @@ type resultMessage struct {
 	error   error
 }
 
-func (o *Opt) execWorker(ctx context.Context) error {
-	pool := workerpool.New(o.config.NumOfWorker)
+// runCheck runs the check of the service once with worker_timeout and returns the result
+func (o *Opt) runCheck(ctx context.Context, service *Service) *ServiceLog {
+	ctx, cancel := context.WithTimeout(ctx, service.WorkerTimeout.Duration)
+	defer cancel()
+	start := time.Now()
+	ch := make(chan resultMessage, 1)
+	go func() {
+		var e error
+		status, message, e := o.execServiceCommandWithRetry(ctx, service)
+		ch <- resultMessage{
+			status:  status,
+			message: message,
+			error:   e,
+		}
+	}()
+	var msg resultMessage
+	select {
+	case msg = <-ch:
+		// nothing
+	case <-ctx.Done():
+		o.metrics.observeTimeout(service)
+		msg = resultMessage{
+			status:  ErrorStatusCode,
+			message: "",
+			error:   fmt.Errorf("command timeout"),
+		}
+	}
+	if msg.error != nil {
+		if msg.message == "" {
+			msg.message = msg.error.Error()
+		}
+	}
+	return &ServiceLog{
+		Time:         time.Now(),
+		CategoryID:   service.categoryID,
+		CategoryName: service.categoryName,
+		ServiceID:    service.ID,
+		Name:         service.Name,
+		Command:      service.Command,
+		Status:       msg.status,
+		Message:      msg.message,
+		Duration:     time.Since(start).Seconds(),
+	}
+}
+
+// checkService runs the check of the service once and appends the result to the log
+func (o *Opt) checkService(ctx context.Context, service *Service) {
+	servicelog := o.runCheck(ctx, service)
+	err := o.appendServiceLog(servicelog)
+	if err != nil {
+		slog.Warn("error in appendlog", slog.Any("error", err))
+	}
+	o.health.checked(service, servicelog.Time)
+	// メンテナンス期間は描画時に更新されるのでロックを取る
+	o.rwlock.RLock()
+	status := service.statusOf(servicelog.Status, servicelog.Time)
+	o.rwlock.RUnlock()
+	o.metrics.observeCheck(service, status, servicelog.Status, servicelog.Time, time.Duration(servicelog.Duration*float64(time.Second)))
+	if o.notifier != nil {
+		o.notifier.observe(service, status, servicelog.Message, servicelog.Time)
+	}
+}
 
-	for _, categeory := range o.config.Categories {
-		for _, s := range categeory.Services {
-			service := s
+// scheduleService submits the check of the service to the pool every worker_interval of the service
+// until ctx is canceled. checks already submitted run with checkCtx, so that they survive a reload
+func (o *Opt) scheduleService(ctx, checkCtx context.Context, pool *workerpool.WorkerPool, service *Service, running *atomic.Bool, render chan<- struct{}) {
+	// 再読み込みでチェックの間隔がリセットされないよう、前回のチェックから数える
+	first := service.WorkerInterval.Duration
+	if last, ok := o.health.lastCheckedAt(service); ok {
+		first = max(time.Until(last.Add(service.WorkerInterval.Duration)), 0)
+	}
+	t := time.NewTimer(first)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			t.Reset(service.WorkerInterval.Duration)
+			// 前回のチェックが終わっていない場合は重ねて実行しない
+			if !running.CompareAndSwap(false, true) {
+				slog.Warn("previous check is still running. skipped", slog.String("category", service.categoryName), slog.String("service", service.Name))
+				continue
+			}
 			pool.Submit(func() {
-				ctx, cancel := context.WithTimeout(ctx, o.config.WorkerTimeout.Duration)
-				ch := make(chan resultMessage, 1)
-				go func() {
-					var e error
-					status, message, e := o.execServiceCommandWithRetry(ctx, service)
-					ch <- resultMessage{
-						status:  status,
-						message: message,
-						error:   e,
-					}
-				}()
-				var msg resultMessage
+				defer running.Store(false)
+				o.checkService(checkCtx, service)
 				select {
-				case msg = <-ch:
-					// nothing
-				case <-ctx.Done():
-					msg = resultMessage{
-						status:  ErrorStatusCode,
-						message: "",
-						error:   fmt.Errorf("command timeout"),
-					}
-				}
-				if msg.error != nil {
-					if msg.message == "" {
-						msg.message = msg.error.Error()
-					}
-				}
-				servicelog := &ServiceLog{
-					Time:         time.Now(),
-					CategoryName: service.categoryName,
-					Name:         service.Name,
-					Command:      service.Command,
-					Status:       msg.status,
-					Message:      msg.message,
+				case render <- struct{}{}:
+				default:
 				}
-				err := o.appendServiceLog(servicelog)
-				if err != nil {
-					slog.Warn("error in appendlog", slog.Any("error", err))
-				}
-				defer cancel()
 			})
+		case <-ctx.Done():
+			return
 		}
 	}
-	pool.StopWait()
-	o.renderStatusPage(ctx)
+}
 
-	return nil
+// startSchedulers starts scheduleService for each service of the current configuration
+func (o *Opt) startSchedulers(ctx, checkCtx context.Context, pool *workerpool.WorkerPool, running map[string]*atomic.Bool, render chan<- struct{}) *sync.WaitGroup {
+	o.rwlock.RLock()
+	defer o.rwlock.RUnlock()
+	var wg sync.WaitGroup
+	now := time.Now()
+	for _, categeory := range o.config.Categories {
+		for _, s := range categeory.Services {
+			service := s
+			key := serviceKey(service)
+			if running[key] == nil {
+				running[key] = &atomic.Bool{}
+			}
+			flag := running[key]
+			o.health.scheduled(service, now)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				o.scheduleService(ctx, checkCtx, pool, service, flag, render)
+			}()
+		}
+	}
+	return &wg
 }
 
 func (o *Opt) startWorker(ctx context.Context) error {
-	t := time.NewTicker(o.config.WorkerInterval.Duration)
-	defer t.Stop()
-LOOP:
+	o.rwlock.RLock()
+	numOfWorker := o.config.NumOfWorker
+	o.rwlock.RUnlock()
+	pool := workerpool.New(numOfWorker)
+	defer pool.StopWait()
+	o.metrics.setPool(pool)
+	o.health.start(time.Now())
+
+	// チェックが終わるたびに再描画する。描画中に終わったチェックはまとめて次の描画に反映する
+	render := make(chan struct{}, 1)
+	// 実行中かどうかは再読み込みをまたいでサービスごとに引き継ぐ
+	running := map[string]*atomic.Bool{}
 	for {
-		select {
-		case <-t.C:
-			o.execWorker(ctx)
-		case <-ctx.Done():
-			break LOOP
+		scheduleCtx, cancel := context.WithCancel(ctx)
+		wg := o.startSchedulers(scheduleCtx, ctx, pool, running, render)
+	LOOP:
+		for {
+			select {
+			case <-render:
+				o.renderStatusPage(ctx)
+			case <-o.reloaded:
+				break LOOP
+			case <-ctx.Done():
+				break LOOP
+			}
+		}
+		cancel()
+		wg.Wait()
+		if ctx.Err() != nil {
+			return nil
 		}
 	}
-	return nil
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecServiceCommandWithRetry(t *testing.T) {
+	opt := newTestOpt(t)
+	count := filepath.Join(t.TempDir(), "count")
+	service := &Service{
+		Command:          []string{"sh", "-c", "echo attempt >> " + count + "; exit 2"},
+		MaxCheckAttempts: 3,
+		RetryInterval:    MustDuration("1ms"),
+	}
+	status, _, err := opt.execServiceCommandWithRetry(context.Background(), service)
+	if err != nil {
+		t.Fatalf("execServiceCommandWithRetry failed: %v", err)
+	}
+	if status != 2 {
+		t.Errorf("status = %d, want 2", status)
+	}
+	data, err := os.ReadFile(count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts := strings.Count(string(data), "attempt"); attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+
+	// Degradedはリトライしない
+	service.DegradedExitCodes = []int{2}
+	start := time.Now()
+	service.RetryInterval = MustDuration("1s")
+	opt.execServiceCommandWithRetry(context.Background(), service)
+	if time.Since(start) >= time.Second {
+		t.Errorf("degraded result should not be retried")
+	}
+}
+
+func TestStartWorker_PerServiceInterval(t *testing.T) {
+	tomlContent := `
+worker_interval = "1h"
+num_of_worker = 2
+
+[[category]]
+name = "Fast"
+worker_interval = "50ms"
+
+  [[category.service]]
+  name = "Ping"
+  command = ["true"]
+
+[[category]]
+name = "Slow"
+
+  [[category.service]]
+  name = "Batch"
+  command = ["sh", "-c", "true"]
+`
+	conf, err := loadToml(writeTempToml(t, tomlContent))
+	if err != nil {
+		t.Fatalf("loadToml failed: %v", err)
+	}
+	opt := &Opt{Data: t.TempDir(), config: conf}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	if err := opt.startWorker(ctx); err != nil {
+		t.Fatalf("startWorker failed: %v", err)
+	}
+
+	fast := countOfDay(opt, conf.Categories[0].Services[0], time.Now())
+	slow := countOfDay(opt, conf.Categories[1].Services[0], time.Now())
+	if fast.operational < 2 {
+		t.Errorf("fast service checked %d times, want >= 2", fast.operational)
+	}
+	if slow.operational != 0 {
+		t.Errorf("slow service checked %d times, want 0", slow.operational)
+	}
+	if conf.Categories[0].Services[0].LatestStatus != Operational {
+		t.Errorf("LatestStatus = %v, want Operational after render", conf.Categories[0].Services[0].LatestStatus)
+	}
+}